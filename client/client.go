@@ -12,18 +12,56 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			exportCommand(os.Args[2:])
+			return
+		case "import":
+			importCommand(os.Args[2:])
+			return
+		}
+	}
+
 	apiHost := flag.String("host", "http://localhost", "Host address of the Hue API server")
-	lightName := flag.String("name", "", "Name of the light to create")
+	lightName := flag.String("name", "", "Name of the light to stage for the next search")
+	lightType := flag.String("type", hueapi.TypeExtendedColor, "Type of the light to stage")
+	username := flag.String("user", "", "Whitelisted username used for api requests")
+	link := flag.Bool("link", false, "Press the virtual link button to allow pairing for 30 seconds")
+	search := flag.Bool("search", false, "Search for new lights, which finds the staged lights")
+	token := flag.String("token", os.Getenv("ADMIN_TOKEN"), "Token for admin requests to a non local server")
 
 	flag.Parse()
 
+	if *link {
+		url := fmt.Sprintf("%s/admin/linkbutton", *apiHost)
+		body := send("POST", url, *token, nil)
+		fmt.Printf("Link button pressed:\n")
+		fmt.Printf("REPLY: %s\n", string(body))
+		return
+	}
+
+	if *search {
+		if *username == "" {
+			fmt.Println("Error: user is required to search for lights")
+			flag.Usage()
+			os.Exit(1)
+		}
+		url := fmt.Sprintf("%s/api/%s/lights", *apiHost, *username)
+		send("POST", url, "", nil)
+		body := send("GET", url+"/new", "", nil)
+		fmt.Printf("Searching for new lights:\n")
+		fmt.Printf("REPLY: %s\n", string(body))
+		return
+	}
+
 	if *lightName == "" {
 		fmt.Println("Error: Light name is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	light := hueapi.LightInfo{Name: *lightName}
+	light := hueapi.LightInfo{Name: *lightName, Type: *lightType}
 
 	jsonData, err := json.Marshal(light)
 	if err != nil {
@@ -31,13 +69,83 @@ func main() {
 		os.Exit(1)
 	}
 
-	url := fmt.Sprintf("%s/api/username/lights", *apiHost)
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonData))
+	url := fmt.Sprintf("%s/admin/staged", *apiHost)
+	body := send("PUT", url, *token, jsonData)
+
+	fmt.Printf("Successfully staged light, search for new lights in the Hue app to add it:\n")
+	fmt.Printf("REPLY: %s\n", string(body))
+}
+
+// exportCommand writes the whole bridge configuration to stdout or a file.
+func exportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	apiHost := flags.String("host", "http://localhost", "Host address of the Hue API server")
+	token := flags.String("token", os.Getenv("ADMIN_TOKEN"), "Token for admin requests to a non local server")
+	format := flags.String("format", "json", "Format of the export, json or yaml")
+	output := flags.String("o", "", "File to write the export to instead of stdout")
+	_ = flags.Parse(args)
+
+	url := fmt.Sprintf("%s/admin/export?format=%s", *apiHost, *format)
+	body := send("GET", url, *token, nil)
+	if *format == "json" {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			body = append(indented.Bytes(), '\n')
+		}
+	}
+
+	if *output == "" {
+		_, _ = os.Stdout.Write(body)
+		return
+	}
+	if err := os.WriteFile(*output, body, 0600); err != nil {
+		fmt.Printf("Error writing export: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// importCommand replaces the bridge configuration with an exported json or yaml file.
+func importCommand(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	apiHost := flags.String("host", "http://localhost", "Host address of the Hue API server")
+	token := flags.String("token", os.Getenv("ADMIN_TOKEN"), "Token for admin requests to a non local server")
+	dryRun := flags.Bool("dry-run", false, "Only show the changes the import would make")
+	flags.Usage = func() {
+		fmt.Printf("Usage: %s import [flags] file\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(1)
+	}
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error reading import: %v\n", err)
+		os.Exit(1)
+	}
+
+	url := fmt.Sprintf("%s/admin/import?dryrun=%t", *apiHost, *dryRun)
+	body := send("POST", url, *token, data)
+	if *dryRun {
+		fmt.Printf("Dry run, changes the import would make:\n")
+	} else {
+		fmt.Printf("Imported, changes made:\n")
+	}
+	fmt.Printf("REPLY: %s\n", string(body))
+}
+
+func send(method, url, token string, jsonData []byte) []byte {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		fmt.Printf("Error creating request: %v\n", err)
 		os.Exit(1)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -57,6 +165,10 @@ func main() {
 		os.Exit(1)
 	}
 
-	fmt.Printf("Successfully created light:\n")
-	fmt.Printf("REPLY: %s\n", string(body))
+	var errorResponse []hueapi.ErrorResponse
+	if json.Unmarshal(body, &errorResponse) == nil && len(errorResponse) > 0 && errorResponse[0].Error != nil {
+		fmt.Printf("Error: %s\n", errorResponse[0].Error.Description)
+		os.Exit(1)
+	}
+	return body
 }
@@ -0,0 +1,259 @@
+package color
+
+import (
+	"fmt"
+	"math"
+)
+
+// https://developers.meethue.com/develop/application-design-guidance/color-conversion-formulas-rgb-to-xy-and-back/
+
+// Point is a color in CIE 1931 xy coordinates.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Gamut is the triangle of xy colors a light can reproduce.
+type Gamut struct {
+	Red   Point
+	Green Point
+	Blue  Point
+}
+
+var (
+	GamutA = Gamut{Red: Point{0.704, 0.296}, Green: Point{0.2151, 0.7106}, Blue: Point{0.138, 0.08}}
+	GamutB = Gamut{Red: Point{0.675, 0.322}, Green: Point{0.409, 0.518}, Blue: Point{0.167, 0.04}}
+	GamutC = Gamut{Red: Point{0.692, 0.308}, Green: Point{0.17, 0.7}, Blue: Point{0.153, 0.048}}
+	// GamutDefault is used for models without a known gamut.
+	GamutDefault = Gamut{Red: Point{1.0, 0}, Green: Point{0.0, 1.0}, Blue: Point{0.0, 0.0}}
+)
+
+var modelGamuts = map[string]Gamut{
+	"LLC001": GamutA, "LLC005": GamutA, "LLC006": GamutA, "LLC007": GamutA, "LLC010": GamutA,
+	"LLC011": GamutA, "LLC012": GamutA, "LLC013": GamutA, "LLC014": GamutA, "LST001": GamutA,
+	"LCT001": GamutB, "LCT002": GamutB, "LCT003": GamutB, "LCT007": GamutB, "LLM001": GamutB,
+	"LCT010": GamutC, "LCT011": GamutC, "LCT012": GamutC, "LCT014": GamutC, "LCT015": GamutC,
+	"LCT016": GamutC, "LLC020": GamutC, "LST002": GamutC,
+}
+
+// GamutForModel returns the gamut of a light modelid.
+func GamutForModel(modelID string) Gamut {
+	if gamut, ok := modelGamuts[modelID]; ok {
+		return gamut
+	}
+	return GamutDefault
+}
+
+// GamutType returns the letter of a known gamut, or "other".
+func GamutType(g Gamut) string {
+	switch g {
+	case GamutA:
+		return "A"
+	case GamutB:
+		return "B"
+	case GamutC:
+		return "C"
+	}
+	return "other"
+}
+
+func cross(a, b Point) float64 {
+	return a.X*b.Y - a.Y*b.X
+}
+
+func sub(a, b Point) Point {
+	return Point{a.X - b.X, a.Y - b.Y}
+}
+
+// epsilon allows for rounding errors of points on the edge of a gamut.
+const epsilon = 1e-9
+
+// Contains reports whether p is inside the gamut triangle.
+func (g Gamut) Contains(p Point) bool {
+	d1 := cross(sub(g.Green, g.Red), sub(p, g.Red))
+	d2 := cross(sub(g.Blue, g.Green), sub(p, g.Green))
+	d3 := cross(sub(g.Red, g.Blue), sub(p, g.Blue))
+	negative := d1 < -epsilon || d2 < -epsilon || d3 < -epsilon
+	positive := d1 > epsilon || d2 > epsilon || d3 > epsilon
+	return !(negative && positive)
+}
+
+// closestOnLine returns the point on the segment a-b closest to p.
+func closestOnLine(a, b, p Point) Point {
+	ab := sub(b, a)
+	t := (ab.X*(p.X-a.X) + ab.Y*(p.Y-a.Y)) / (ab.X*ab.X + ab.Y*ab.Y)
+	t = max(0, min(1, t))
+	return Point{a.X + ab.X*t, a.Y + ab.Y*t}
+}
+
+func distance(a, b Point) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// Clamp returns p when it is inside the gamut, or the closest point on the edge of the gamut otherwise.
+func (g Gamut) Clamp(p Point) Point {
+	if g.Contains(p) {
+		return p
+	}
+	closest := closestOnLine(g.Red, g.Green, p)
+	for _, candidate := range []Point{closestOnLine(g.Green, g.Blue, p), closestOnLine(g.Blue, g.Red, p)} {
+		if distance(candidate, p) < distance(closest, p) {
+			closest = candidate
+		}
+	}
+	return closest
+}
+
+// RGB is a color with 8 bits per channel.
+type RGB struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+// Hex returns the color in #rrggbb notation.
+func (c RGB) Hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func gamma(v float64) float64 {
+	if v > 0.04045 {
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	return v / 12.92
+}
+
+func reverseGamma(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// whitePoint is returned for black, which has no chromaticity.
+var whitePoint = Point{0.3227, 0.329}
+
+// rgbToXY converts rgb components in the range 0..1 to xy.
+func rgbToXY(r, g, b float64) Point {
+	r, g, b = gamma(r), gamma(g), gamma(b)
+	x := r*0.664511 + g*0.154324 + b*0.162028
+	y := r*0.283881 + g*0.668433 + b*0.047685
+	z := r*0.000088 + g*0.072310 + b*0.986039
+	sum := x + y + z
+	if sum == 0 {
+		return whitePoint
+	}
+	return Point{x / sum, y / sum}
+}
+
+// xyToRGB converts xy at a brightness in the range 0..1 to rgb components in the range 0..1.
+func xyToRGB(p Point, brightness float64) (float64, float64, float64) {
+	if p.Y == 0 {
+		p = whitePoint
+	}
+	z := 1 - p.X - p.Y
+	y := brightness
+	x := (y / p.Y) * p.X
+	z = (y / p.Y) * z
+	r := x*1.656492 - y*0.354851 - z*0.255038
+	g := -x*0.707196 + y*1.655397 + z*0.036152
+	b := x*0.051713 - y*0.121364 + z*1.011530
+	r, g, b = max(0, r), max(0, g), max(0, b)
+	if m := max(r, g, b); m > 1 {
+		r, g, b = r/m, g/m, b/m
+	}
+	return clamp01(reverseGamma(r)), clamp01(reverseGamma(g)), clamp01(reverseGamma(b))
+}
+
+func clamp01(v float64) float64 {
+	return max(0, min(1, v))
+}
+
+// XYToRGB converts xy at the hue brightness 0..254 to RGB.
+func XYToRGB(p Point, bri uint8) RGB {
+	r, g, b := xyToRGB(p, float64(bri)/254)
+	return RGB{R: uint8(math.Round(r * 255)), G: uint8(math.Round(g * 255)), B: uint8(math.Round(b * 255))}
+}
+
+// HueSatToXY converts the hue 0..65535 and saturation 0..254 of a light to xy.
+func HueSatToXY(hue uint16, sat uint8) Point {
+	h := float64(hue) / 65536 * 6
+	s := float64(sat) / 254
+	sector := math.Floor(h)
+	f := h - sector
+	p, q, t := 1-s, 1-s*f, 1-s*(1-f)
+	switch int(sector) {
+	case 0:
+		return rgbToXY(1, t, p)
+	case 1:
+		return rgbToXY(q, 1, p)
+	case 2:
+		return rgbToXY(p, 1, t)
+	case 3:
+		return rgbToXY(p, q, 1)
+	case 4:
+		return rgbToXY(t, p, 1)
+	default:
+		return rgbToXY(1, p, q)
+	}
+}
+
+// XYToHueSat converts xy to the hue 0..65535 and saturation 0..254 of a light.
+func XYToHueSat(p Point) (uint16, uint8) {
+	r, g, b := xyToRGB(p, 1)
+	high, low := max(r, g, b), min(r, g, b)
+	delta := high - low
+	if high == 0 || delta == 0 {
+		return 0, 0
+	}
+	var h float64
+	switch high {
+	case r:
+		h = math.Mod((g-b)/delta, 6)
+	case g:
+		h = (b-r)/delta + 2
+	default:
+		h = (r-g)/delta + 4
+	}
+	if h < 0 {
+		h += 6
+	}
+	sat := uint8(math.Round(delta / high * 254))
+	if sat == 0 {
+		return 0, 0
+	}
+	return uint16(int(math.Round(h/6*65536)) % 65536), sat
+}
+
+// MirekToXY converts a color temperature in mirek to xy on the planckian locus.
+func MirekToXY(mirek uint16) Point {
+	// Kim et al. cubic spline approximation, valid from 1667K to 25000K
+	t := max(1667, min(25000, 1e6/float64(max(mirek, 1))))
+	var x float64
+	if t <= 4000 {
+		x = -0.2661239e9/(t*t*t) - 0.2343589e6/(t*t) + 0.8776956e3/t + 0.179910
+	} else {
+		x = -3.0258469e9/(t*t*t) + 2.1070379e6/(t*t) + 0.2226347e3/t + 0.240390
+	}
+	var y float64
+	switch {
+	case t <= 2222:
+		y = -1.1063814*x*x*x - 1.34811020*x*x + 2.18555832*x - 0.20219683
+	case t <= 4000:
+		y = -0.9549476*x*x*x - 1.37418593*x*x + 2.09137015*x - 0.16748867
+	default:
+		y = 3.0817580*x*x*x - 5.87338670*x*x + 3.75112997*x - 0.37001483
+	}
+	return Point{x, y}
+}
+
+// XYToMirek converts xy to the correlated color temperature in mirek.
+func XYToMirek(p Point) uint16 {
+	// McCamy's approximation
+	n := (p.X - 0.3320) / (0.1858 - p.Y)
+	cct := 449*n*n*n + 3525*n*n + 6823.3*n + 5520.33
+	if cct <= 1e6/65535 {
+		return math.MaxUint16
+	}
+	return uint16(max(1, math.Round(1e6/cct)))
+}
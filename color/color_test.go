@@ -0,0 +1,59 @@
+package color
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGamutForModel(t *testing.T) {
+	assert.Equal(t, GamutA, GamutForModel("LST001"))
+	assert.Equal(t, GamutB, GamutForModel("LCT007"))
+	assert.Equal(t, GamutC, GamutForModel("LCT015"))
+	assert.Equal(t, GamutDefault, GamutForModel("unknown"))
+}
+
+func TestGamutClamp(t *testing.T) {
+	inside := Point{0.4, 0.4}
+	assert.True(t, GamutB.Contains(inside))
+	assert.Equal(t, inside, GamutB.Clamp(inside))
+	assert.True(t, GamutB.Contains(GamutB.Red))
+
+	for _, p := range []Point{{0.9, 0.1}, {0.1, 0.9}, {0, 0}, {0.3, 0.4}} {
+		assert.False(t, GamutB.Contains(p), p)
+		assert.True(t, GamutB.Contains(GamutB.Clamp(p)), p)
+	}
+	assert.Equal(t, GamutB.Green, GamutB.Clamp(Point{0.1, 0.9}))
+}
+
+func TestHueSatRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		hue uint16
+		sat uint8
+	}{{0, 254}, {10000, 254}, {21845, 254}, {43690, 200}, {50000, 100}, {0, 0}} {
+		hue, sat := XYToHueSat(HueSatToXY(tc.hue, tc.sat))
+		assert.InDelta(t, tc.hue, hue, 200, tc)
+		assert.InDelta(t, tc.sat, sat, 2, tc)
+	}
+}
+
+func TestMirekRoundTrip(t *testing.T) {
+	for _, mirek := range []uint16{153, 250, 366, 454} {
+		p := MirekToXY(mirek)
+		// McCamy's approximation is within about one percent
+		assert.InEpsilon(t, mirek, XYToMirek(p), 0.01, mirek)
+	}
+	// warm white is close to the incandescent point
+	p := MirekToXY(370)
+	assert.InDelta(t, 0.4578, p.X, 0.005)
+	assert.InDelta(t, 0.4101, p.Y, 0.005)
+}
+
+func TestXYToRGB(t *testing.T) {
+	assert.Equal(t, "#ffffff", XYToRGB(Point{0.3227, 0.329}, 254).Hex())
+	assert.Equal(t, "#000000", XYToRGB(Point{0.3227, 0.329}, 0).Hex())
+	red := XYToRGB(GamutC.Red, 254)
+	assert.Equal(t, uint8(255), red.R)
+	assert.Less(t, red.G, uint8(60))
+	assert.Less(t, red.B, uint8(60))
+}
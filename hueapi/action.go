@@ -0,0 +1,351 @@
+package hueapi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultActionTimeout = 5 * time.Second
+	defaultRetryDelay    = 500 * time.Millisecond
+)
+
+// Action is an outbound webhook invoked after a state change is applied to a light.
+//
+// Body is a text/template executed with the LightEvent of the change, for example
+//
+//	{"power": {{if .State.On}}"on"{{else}}"off"{{end}}, "brightness": {{.State.Bri}}}
+//
+// With Transitions set the action is also invoked for the intermediate states of a transition and
+// the states of a running colorloop.
+type Action struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	Retries int               `json:"retries,omitempty"`
+
+	Transitions bool `json:"transitions,omitempty"`
+}
+
+// LightEvent describes a state change that was applied to a light.
+//
+// Events with Transition set carry an intermediate state of a running transition, events with
+// Effect set a state of a running colorloop. The event of a change that starts a transition has
+// Target set, it is followed by the Transition events ending on the same state.
+type LightEvent struct {
+	ID         string
+	Light      *LightInfo
+	State      LightState
+	Previous   LightState
+	Change     *StateChange
+	Transition bool
+	Effect     bool
+	Target     bool
+}
+
+// Relevant reports whether the event is relevant to a consumer that does or does not follow the
+// intermediate states. Those that do skip the target of a transition as the transition ends on it.
+func (e *LightEvent) Relevant(transitions bool) bool {
+	if transitions {
+		return !e.Target
+	}
+	return !e.Transition && !e.Effect
+}
+
+// LightCallback is invoked after a state change has been persisted.
+type LightCallback func(e *LightEvent)
+
+// Validate checks that the action can be invoked.
+func (a *Action) Validate() error {
+	if a.URL == "" {
+		return fmt.Errorf("action url is required")
+	}
+	if !strings.HasPrefix(a.URL, "http://") && !strings.HasPrefix(a.URL, "https://") {
+		return fmt.Errorf("action url %q must be http or https", a.URL)
+	}
+	if a.Retries < 0 {
+		return fmt.Errorf("action retries must not be negative")
+	}
+	if _, err := a.timeout(); err != nil {
+		return err
+	}
+	_, err := a.template()
+	return err
+}
+
+func (a *Action) method() string {
+	if a.Method == "" {
+		return http.MethodPost
+	}
+	return strings.ToUpper(a.Method)
+}
+
+func (a *Action) timeout() (time.Duration, error) {
+	if a.Timeout == "" {
+		return defaultActionTimeout, nil
+	}
+	timeout, err := time.ParseDuration(a.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid action timeout %q: %w", a.Timeout, err)
+	}
+	return timeout, nil
+}
+
+func (a *Action) template() (*template.Template, error) {
+	return template.New("body").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			marshal, err := json.Marshal(v)
+			return string(marshal), err
+		},
+	}).Parse(a.Body)
+}
+
+func (a *Action) request(ctx context.Context, event *LightEvent) (*http.Request, error) {
+	tmpl, err := a.template()
+	if err != nil {
+		return nil, err
+	}
+	body := &bytes.Buffer{}
+	if err = tmpl.Execute(body, event); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, a.method(), a.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range a.Headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (a *Action) invoke(event *LightEvent) error {
+	timeout, err := a.timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := a.request(ctx, event)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s returned status %d", req.Method, a.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+// AddLightCallback registers a callback that is run after each light state change.
+func (h *HueApi) AddLightCallback(callback LightCallback) {
+	h.callbacks = append(h.callbacks, callback)
+}
+
+func (h *HueApi) lightChanged(e *LightEvent) {
+	h.startTransition(e)
+	h.startEffect(e)
+	h.notify(e)
+}
+
+func (h *HueApi) notify(e *LightEvent) {
+	for _, callback := range h.callbacks {
+		callback(e)
+	}
+}
+
+// actionWorker invokes the action of one light for its events in order, of the events arriving
+// meanwhile only the latest waits.
+type actionWorker struct {
+	latest *LightEvent
+	signal chan struct{}
+}
+
+// ActionCallback queues the event for the webhook configured for the light, if any, which is
+// invoked in the background. A newer event of the light replaces one still waiting so the
+// webhook always receives the latest state last.
+func (h *HueApi) ActionCallback(e *LightEvent) {
+	action, err := h.cachedAction(e.ID)
+	if err != nil {
+		h.logger.Errorf("light %s action lookup error: %s", e.ID, err)
+		return
+	}
+	if action == nil || !e.Relevant(action.Transitions) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown {
+		return
+	}
+	w, ok := h.actionWorkers[e.ID]
+	if !ok {
+		w = &actionWorker{signal: make(chan struct{}, 1)}
+		if h.actionWorkers == nil {
+			h.actionWorkers = make(map[string]*actionWorker)
+		}
+		h.actionWorkers[e.ID] = w
+		h.running.Add(1)
+		go h.runActions(e.ID, w)
+	}
+	w.latest = e
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+// runActions invokes the action for the queued events of a light until none is left.
+func (h *HueApi) runActions(id string, w *actionWorker) {
+	defer h.running.Done()
+	for {
+		h.mu.Lock()
+		e := w.latest
+		w.latest = nil
+		if e == nil || h.shutdown {
+			delete(h.actionWorkers, id)
+			h.mu.Unlock()
+			return
+		}
+		h.mu.Unlock()
+
+		// the action may have been changed or removed while the event was waiting
+		action, err := h.cachedAction(id)
+		if err != nil {
+			h.logger.Errorf("light %s action lookup error: %s", id, err)
+			continue
+		}
+		if action != nil && e.Relevant(action.Transitions) {
+			h.runAction(action, w, e)
+		}
+	}
+}
+
+func (h *HueApi) runAction(action *Action, w *actionWorker, e *LightEvent) {
+	delay := defaultRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := action.invoke(e)
+		if err == nil {
+			return
+		}
+		if attempt >= action.Retries {
+			h.logger.Errorf("light %s action failed after %d attempt(s): %s", e.ID, attempt+1, err)
+			return
+		}
+		h.logger.Errorf("light %s action attempt %d failed, retrying: %s", e.ID, attempt+1, err)
+		if !h.waitRetry(w, delay) {
+			h.logger.Infof("light %s action retry dropped for a newer state", e.ID)
+			return
+		}
+		delay *= 2
+	}
+}
+
+// waitRetry waits delay before a retry, false when a newer event of the light is waiting or on
+// shutdown so a stale state is never sent after a newer one.
+func (h *HueApi) waitRetry(w *actionWorker, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			return !h.superseded(w)
+		case <-w.signal:
+			if h.superseded(w) {
+				return false
+			}
+		}
+	}
+}
+
+func (h *HueApi) superseded(w *actionWorker) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return w.latest != nil || h.shutdown
+}
+
+// cachedAction returns the action of the light from a cache of the stored actions, loading them
+// on first use so events do not read the database.
+func (h *HueApi) cachedAction(id string) (*Action, error) {
+	h.mu.Lock()
+	actions, version := h.actions, h.actionsVersion
+	h.mu.Unlock()
+	if actions == nil {
+		var err error
+		if actions, err = h.GetActions(); err != nil {
+			return nil, err
+		}
+		h.mu.Lock()
+		// the actions may have been written while loading
+		if h.actionsVersion == version {
+			h.actions = actions
+		}
+		h.mu.Unlock()
+	}
+	return actions[id], nil
+}
+
+// invalidateActions drops the cached actions once they have been written.
+func (h *HueApi) invalidateActions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.actions = nil
+	h.actionsVersion++
+}
+
+func (h *HueApi) AdminGetAction(c *gin.Context) {
+	action, err := h.GetAction(c.Param("lightId"))
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if action == nil {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, action)
+}
+
+func (h *HueApi) AdminPutAction(c *gin.Context) {
+	action := &Action{}
+	if err := c.ShouldBindJSON(action); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := action.Validate(); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.PutAction(c.Param("lightId"), action); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, action)
+}
+
+func (h *HueApi) AdminDeleteAction(c *gin.Context) {
+	if err := h.DeleteAction(c.Param("lightId")); err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
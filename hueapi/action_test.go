@@ -0,0 +1,153 @@
+package hueapi
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{ t *testing.T }
+
+func (l *testLogger) Infof(format string, args ...interface{})  { l.t.Logf(format, args...) }
+func (l *testLogger) Errorf(format string, args ...interface{}) { l.t.Logf(format, args...) }
+
+func TestActionInvokedWithTemplatedBody(t *testing.T) {
+	h := setupTestDB(t)
+	h.logger = &testLogger{t}
+
+	var calls atomic.Int32
+	bodies := make(chan string, 5)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// fail the first attempt to exercise retries
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		body, _ := io.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer server.Close()
+
+	_, lightId, err := h.PutLight(&LightInfo{Name: "Lamp"})
+	assert.NoError(t, err)
+
+	action := &Action{
+		URL:     server.URL,
+		Method:  "put",
+		Headers: map[string]string{"X-Token": "secret"},
+		Body:    `{"id":"{{.ID}}","on":{{.State.On}},"bri":{{.State.Bri}}}`,
+		Retries: 1,
+	}
+	assert.NoError(t, action.Validate())
+	assert.NoError(t, h.PutAction(lightId, action))
+
+	light, err := h.GetLight(lightId)
+	assert.NoError(t, err)
+	on, bri := false, uint8(10)
+	change := &StateChange{On: &on, Bri: &bri}
+	light.ApplyStateChange(lightId, change)
+	h.ActionCallback(&LightEvent{ID: lightId, Light: light, State: light.State, Change: change})
+
+	select {
+	case body := <-bodies:
+		assert.Equal(t, `{"id":"1","on":false,"bri":10}`, body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("action was not invoked")
+	}
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestActionValidate(t *testing.T) {
+	assert.Error(t, (&Action{}).Validate())
+	assert.Error(t, (&Action{URL: "ftp://example.com"}).Validate())
+	assert.Error(t, (&Action{URL: "http://example.com", Timeout: "soon"}).Validate())
+	assert.Error(t, (&Action{URL: "http://example.com", Body: "{{.State"}).Validate())
+	assert.NoError(t, (&Action{URL: "http://example.com", Timeout: "2s"}).Validate())
+}
+
+func TestDeleteLightRemovesAction(t *testing.T) {
+	h := setupTestDB(t)
+
+	_, lightId, err := h.PutLight(&LightInfo{Name: "Lamp"})
+	assert.NoError(t, err)
+	assert.NoError(t, h.PutAction(lightId, &Action{URL: "http://example.com"}))
+	assert.Error(t, h.PutAction("42", &Action{URL: "http://example.com"}))
+
+	assert.NoError(t, h.DeleteLight(lightId))
+	action, err := h.GetAction(lightId)
+	assert.NoError(t, err)
+	assert.Nil(t, action)
+}
+
+func TestActionOrder(t *testing.T) {
+	h := setupTestDB(t)
+	h.logger = &testLogger{t}
+
+	var mu sync.Mutex
+	var received []string
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, string(body))
+		first := len(received) == 1
+		mu.Unlock()
+		if first {
+			// hold and then fail the first state, the light changes meanwhile
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	_, lightId, err := h.PutLight(&LightInfo{Name: "Lamp"})
+	require.NoError(t, err)
+	require.NoError(t, h.PutAction(lightId, &Action{URL: server.URL, Body: `{{.State.Bri}}`, Retries: 3}))
+	event := func(bri uint8) *LightEvent {
+		return &LightEvent{ID: lightId, Light: &LightInfo{}, State: LightState{Bri: bri}}
+	}
+
+	h.ActionCallback(event(1))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	// while the first state is sent only the latest of the following states waits
+	for bri := uint8(2); bri <= 5; bri++ {
+		h.ActionCallback(event(bri))
+	}
+	// ticks of a transition are not sent to actions without transitions
+	tick := event(7)
+	tick.Transition = true
+	h.ActionCallback(tick)
+	close(release)
+
+	// the failed state is not retried after the newer one
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+	time.Sleep(2 * defaultRetryDelay)
+	mu.Lock()
+	assert.Equal(t, []string{"1", "5"}, received)
+	mu.Unlock()
+
+	// the cached action follows changes of the stored action
+	require.NoError(t, h.DeleteAction(lightId))
+	h.ActionCallback(event(6))
+	h.Shutdown()
+	mu.Lock()
+	assert.Equal(t, []string{"1", "5"}, received)
+	mu.Unlock()
+}
@@ -0,0 +1,312 @@
+package hueapi
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// https://developers.meethue.com/develop/hue-api/7-configuration-api/
+
+const (
+	bridgeModelID          = "BSB002"
+	bridgeSWVersion        = "1941132080"
+	bridgeAPIVersion       = "1.41.0"
+	bridgeDatastoreVersion = "98"
+)
+
+var zigbeeChannels = []int{11, 15, 20, 25}
+
+// BridgeSettings are the persisted, modifiable parts of the bridge configuration.
+type BridgeSettings struct {
+	Name          string `json:"name"`
+	ZigbeeChannel int    `json:"zigbeechannel"`
+	Timezone      string `json:"timezone"`
+	ProxyAddress  string `json:"proxyaddress"`
+	ProxyPort     int    `json:"proxyport"`
+}
+
+func DefaultBridgeSettings() *BridgeSettings {
+	return &BridgeSettings{
+		Name:          "Philips hue",
+		ZigbeeChannel: 15,
+		Timezone:      "Etc/UTC",
+		ProxyAddress:  "none",
+	}
+}
+
+// ShortConfig is returned by /api/config and to users that are not whitelisted.
+type ShortConfig struct {
+	Name             string `json:"name"`
+	DatastoreVersion string `json:"datastoreversion"`
+	SWVersion        string `json:"swversion"`
+	APIVersion       string `json:"apiversion"`
+	Mac              string `json:"mac"`
+	BridgeID         string `json:"bridgeid"`
+	FactoryNew       bool   `json:"factorynew"`
+	ReplacesBridgeID any    `json:"replacesbridgeid"`
+	ModelID          string `json:"modelid"`
+	StarterKitID     string `json:"starterkitid"`
+}
+
+type BridgeConfig struct {
+	ShortConfig
+	ZigbeeChannel    int                        `json:"zigbeechannel"`
+	DHCP             bool                       `json:"dhcp"`
+	IPAddress        string                     `json:"ipaddress"`
+	Netmask          string                     `json:"netmask"`
+	Gateway          string                     `json:"gateway"`
+	ProxyAddress     string                     `json:"proxyaddress"`
+	ProxyPort        int                        `json:"proxyport"`
+	UTC              string                     `json:"UTC"`
+	LocalTime        string                     `json:"localtime"`
+	Timezone         string                     `json:"timezone"`
+	LinkButton       bool                       `json:"linkbutton"`
+	PortalServices   bool                       `json:"portalservices"`
+	PortalConnection string                     `json:"portalconnection"`
+	Whitelist        map[string]*WhitelistEntry `json:"whitelist"`
+}
+
+// ConfigChange holds the modifiable attributes of a configuration update.
+type ConfigChange struct {
+	Name          *string `json:"name,omitempty"`
+	ZigbeeChannel *int    `json:"zigbeechannel,omitempty"`
+	Timezone      *string `json:"timezone,omitempty"`
+	ProxyAddress  *string `json:"proxyaddress,omitempty"`
+	ProxyPort     *int    `json:"proxyport,omitempty"`
+}
+
+// notModifiable lists configuration attributes that are reported but cannot be changed, the link
+// button is only pressed through the admin api.
+var notModifiable = []string{"bridgeid", "mac", "modelid", "swversion", "apiversion", "datastoreversion",
+	"ipaddress", "netmask", "gateway", "dhcp", "UTC", "whitelist", "factorynew", "replacesbridgeid", "starterkitid",
+	"linkbutton"}
+
+// bridgeMac derives the mac address from a bridge id, which is the mac with FFFE inserted in the middle.
+func bridgeMac(bridgeId string) string {
+	id := strings.ToLower(bridgeId)
+	if len(id) != 16 {
+		return ""
+	}
+	mac := id[:6] + id[10:]
+	parts := make([]string, 0, 6)
+	for i := 0; i < len(mac); i += 2 {
+		parts = append(parts, mac[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+// ipNetwork returns the ip address the api listens on and the netmask of its interface. When
+// listening on all addresses the address of the outbound, or else the first non loopback, interface
+// is reported.
+func (h *HueApi) ipNetwork() (string, string) {
+	host, _, err := net.SplitHostPort(h.addr)
+	if err != nil {
+		return "", ""
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return host, ""
+	}
+	if ip := net.ParseIP(host); host == "" || ip.IsUnspecified() {
+		host = ""
+		if outbound := outboundIP(); outbound != nil {
+			host = outbound.String()
+		}
+	}
+	var fallback *net.IPNet
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.String() == host {
+			return host, net.IP(ipNet.Mask).String()
+		}
+		if fallback == nil && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() {
+			fallback = ipNet
+		}
+	}
+	if host == "" && fallback != nil {
+		return fallback.IP.String(), net.IP(fallback.Mask).String()
+	}
+	return host, ""
+}
+
+// outboundIP returns the local address used to reach other networks, nil without a default route.
+// Connecting a udp socket only selects the route, nothing is sent.
+func outboundIP() net.IP {
+	conn, err := net.Dial("udp4", "192.0.2.1:9")
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = conn.Close() }()
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		return addr.IP
+	}
+	return nil
+}
+
+func (h *HueApi) shortConfig(settings *BridgeSettings) ShortConfig {
+	config := ShortConfig{
+		Name:             settings.Name,
+		DatastoreVersion: bridgeDatastoreVersion,
+		SWVersion:        bridgeSWVersion,
+		APIVersion:       bridgeAPIVersion,
+		ModelID:          bridgeModelID,
+	}
+	if len(h.bridges) > 0 {
+		config.BridgeID = strings.ToUpper(h.bridges[0].SerialNumber)
+		config.Mac = bridgeMac(config.BridgeID)
+	}
+	return config
+}
+
+func (h *HueApi) fullConfig(settings *BridgeSettings, users map[string]*WhitelistEntry) *BridgeConfig {
+	now := time.Now()
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	ipAddress, netmask := h.ipNetwork()
+	return &BridgeConfig{
+		ShortConfig:      h.shortConfig(settings),
+		ZigbeeChannel:    settings.ZigbeeChannel,
+		DHCP:             true,
+		IPAddress:        ipAddress,
+		Netmask:          netmask,
+		Gateway:          "0.0.0.0",
+		ProxyAddress:     settings.ProxyAddress,
+		ProxyPort:        settings.ProxyPort,
+		UTC:              now.UTC().Format(hueTimeFormat),
+		LocalTime:        now.In(location).Format(hueTimeFormat),
+		Timezone:         settings.Timezone,
+		LinkButton:       h.LinkButtonPressed(),
+		PortalConnection: "disconnected",
+		Whitelist:        users,
+	}
+}
+
+// apply validates and sets the attributes in change, returning the success entries.
+func (s *BridgeSettings) apply(change *ConfigChange) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	success := func(attribute string, value any) {
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{"/config/" + attribute: value},
+		})
+	}
+	if change.Name != nil {
+		if len(*change.Name) < 4 || len(*change.Name) > 16 {
+			return nil, NewError(ErrorInvalidValue, "/config/name", *change.Name, "name")
+		}
+		s.Name = *change.Name
+		success("name", s.Name)
+	}
+	if change.ZigbeeChannel != nil {
+		if !slices.Contains(zigbeeChannels, *change.ZigbeeChannel) {
+			return nil, NewError(ErrorInvalidValue, "/config/zigbeechannel",
+				fmt.Sprint(*change.ZigbeeChannel), "zigbeechannel")
+		}
+		s.ZigbeeChannel = *change.ZigbeeChannel
+		success("zigbeechannel", s.ZigbeeChannel)
+	}
+	if change.Timezone != nil {
+		if _, err := time.LoadLocation(*change.Timezone); err != nil || *change.Timezone == "" {
+			return nil, NewError(ErrorInvalidValue, "/config/timezone", *change.Timezone, "timezone")
+		}
+		s.Timezone = *change.Timezone
+		success("timezone", s.Timezone)
+	}
+	if change.ProxyAddress != nil {
+		s.ProxyAddress = *change.ProxyAddress
+		success("proxyaddress", s.ProxyAddress)
+	}
+	if change.ProxyPort != nil {
+		if *change.ProxyPort < 0 || *change.ProxyPort > 65535 {
+			return nil, NewError(ErrorInvalidValue, "/config/proxyport", fmt.Sprint(*change.ProxyPort), "proxyport")
+		}
+		s.ProxyPort = *change.ProxyPort
+		success("proxyport", s.ProxyPort)
+	}
+	return response, nil
+}
+
+// ShortConfigHandler serves the unauthenticated configuration used during discovery.
+func (h *HueApi) ShortConfigHandler(c *gin.Context) {
+	settings, err := h.GetSettings()
+	if err != nil {
+		abortWithError(c, "/config", err)
+		return
+	}
+	c.JSON(http.StatusOK, h.shortConfig(settings))
+}
+
+// Config serves the full configuration to whitelisted users and the short configuration to others.
+func (h *HueApi) Config(c *gin.Context) {
+	settings, err := h.GetSettings()
+	if err != nil {
+		abortWithError(c, "/config", err)
+		return
+	}
+	user, err := h.GetUser(c.Param("user"))
+	if err != nil {
+		abortWithError(c, "/config", err)
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusOK, h.shortConfig(settings))
+		return
+	}
+	users, err := h.GetUsers()
+	if err != nil {
+		abortWithError(c, "/config", err)
+		return
+	}
+	c.JSON(http.StatusOK, h.fullConfig(settings, users))
+}
+
+func (h *HueApi) ApiUpdateConfig(c *gin.Context) {
+	attributes := map[string]any{}
+	if err := c.ShouldBindBodyWithJSON(&attributes); err != nil {
+		abortWithErrors(c, bindError("/config", err))
+		return
+	}
+	var errs []*HueError
+	for attribute := range attributes {
+		if slices.Contains(notModifiable, attribute) {
+			errs = append(errs, NewError(ErrorParameterNotModifiable, "/config/"+attribute, attribute))
+		} else if !slices.Contains([]string{"name", "zigbeechannel", "timezone", "proxyaddress", "proxyport"}, attribute) {
+			errs = append(errs, NewError(ErrorParameterNotAvailable, "/config/"+attribute, attribute))
+		}
+	}
+	if len(errs) > 0 {
+		abortWithErrors(c, errs...)
+		return
+	}
+
+	change := &ConfigChange{}
+	if err := c.ShouldBindBodyWithJSON(change); err != nil {
+		abortWithErrors(c, bindError("/config", err))
+		return
+	}
+	response, err := h.UpdateSettings(change)
+	if err != nil {
+		abortWithError(c, "/config", err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *HueApi) ApiDeleteWhitelist(c *gin.Context) {
+	username := c.Param("username")
+	address := "/config/whitelist/" + username
+	if err := h.DeleteUser(username); err != nil {
+		abortWithError(c, address, err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": address + " deleted"}})
+}
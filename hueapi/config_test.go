@@ -0,0 +1,76 @@
+package hueapi
+
+import (
+	"net"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/mlctrez/ehugo/ssdp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig(t *testing.T) {
+	h := setupTestApi(t)
+	h.bridges = []*ssdp.BridgeInfo{{SerialNumber: "001788FFFE23BFC1"}}
+	user := testUser(t, h)
+
+	for _, path := range []string{"/api/config", "/api/nouser/config"} {
+		short := map[string]any{}
+		assert.NoError(t, json.Unmarshal(request(h, "GET", path, "").Body.Bytes(), &short))
+		assert.Equal(t, "001788FFFE23BFC1", short["bridgeid"], path)
+		assert.Equal(t, "00:17:88:23:bf:c1", short["mac"], path)
+		assert.Equal(t, "BSB002", short["modelid"], path)
+		assert.NotContains(t, short, "whitelist", path)
+	}
+
+	recorder := request(h, "PUT", "/api/"+user+"/config", `{"name":"Downstairs","zigbeechannel":20}`)
+	assert.JSONEq(t, `[{"success":{"/config/name":"Downstairs"}},{"success":{"/config/zigbeechannel":20}}]`,
+		recorder.Body.String())
+
+	config := &BridgeConfig{}
+	assert.NoError(t, json.Unmarshal(request(h, "GET", "/api/"+user+"/config", "").Body.Bytes(), config))
+	assert.Equal(t, "Downstairs", config.Name)
+	assert.Equal(t, 20, config.ZigbeeChannel)
+	assert.Equal(t, "1.41.0", config.APIVersion)
+	assert.Contains(t, config.Whitelist, user)
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/config", `{"zigbeechannel":12}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+	}
+	errs = hueErrors(t, request(h, "PUT", "/api/"+user+"/config", `{"bridgeid":"x"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorParameterNotModifiable, errs[0].Type)
+	}
+
+	errs = hueErrors(t, request(h, "PUT", "/api/"+user+"/config", `{"linkbutton":true}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorParameterNotModifiable, errs[0].Type)
+	}
+	assert.False(t, h.LinkButtonPressed())
+
+	recorder = request(h, "DELETE", "/api/"+user+"/config/whitelist/"+user, "")
+	assert.JSONEq(t, `[{"success":"/config/whitelist/`+user+` deleted"}]`, recorder.Body.String())
+}
+
+func TestIPNetwork(t *testing.T) {
+	h := &HueApi{addr: "127.0.0.1:80"}
+	ip, netmask := h.ipNetwork()
+	assert.Equal(t, "127.0.0.1", ip)
+	assert.Equal(t, "255.0.0.0", netmask)
+
+	// listening on all addresses reports a non loopback address when there is one
+	for _, addr := range []string{":80", "0.0.0.0:80"} {
+		h.addr = addr
+		ip, netmask = h.ipNetwork()
+		if outboundIP() == nil && ip == "" {
+			t.Skip("no non loopback interface")
+		}
+		parsed := net.ParseIP(ip)
+		if assert.NotNil(t, parsed, addr) {
+			assert.False(t, parsed.IsLoopback(), addr)
+			assert.False(t, parsed.IsUnspecified(), addr)
+		}
+		assert.NotEmpty(t, netmask, addr)
+	}
+}
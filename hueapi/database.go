@@ -3,124 +3,829 @@ package hueapi
 import (
 	"encoding/json"
 	"fmt"
-	"go.etcd.io/bbolt"
+	"slices"
+	"strings"
+	"time"
 )
 
+// SetupBolt prepares the store, a bbolt database is migrated to SchemaVersion. An imported bridge identity is loaded.
 func (h *HueApi) SetupBolt() error {
-	return h.boltDb.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("lights"))
-		return err
+	if store, ok := h.store.(*boltStore); ok {
+		if err := h.migrate(store.db); err != nil {
+			return err
+		}
+	}
+	return h.loadIdentity()
+}
+
+// update runs fn in a single read-write transaction of the store, lights accesses the lights within it.
+func (h *HueApi) update(fn func(tx Tx, lights LightTx) error) error {
+	return h.store.Update(func(tx Tx) error {
+		return fn(tx, lightTx{tx})
+	})
+}
+
+// view runs fn in a single read-only transaction of the store, lights accesses the lights within it.
+func (h *HueApi) view(fn func(tx Tx, lights LightTx) error) error {
+	return h.store.View(func(tx Tx) error {
+		return fn(tx, lightTx{tx})
 	})
 }
 
 func (h *HueApi) GetLights() (map[string]*LightInfo, error) {
+	var result map[string]*LightInfo
+	err := h.view(func(_ Tx, lights LightTx) (err error) {
+		result, err = lights.Lights()
+		return err
+	})
+	return result, err
+}
+
+func (h *HueApi) GetLight(id string) (*LightInfo, error) {
+	var result *LightInfo
+	err := h.view(func(_ Tx, lights LightTx) (err error) {
+		result, err = lights.Light(id)
+		return err
+	})
+	return result, err
+}
+
+func (h *HueApi) PutLight(light *LightInfo) (*LightInfo, string, error) {
+	var lightId string
+	err := h.update(func(_ Tx, lights LightTx) (err error) {
+		lightId, err = lights.Insert(light)
+		return err
+	})
+	return light, lightId, err
+}
+
+// DeleteLight removes the light along with its action and its references in groups and scenes.
+func (h *HueApi) DeleteLight(lightId string) error {
+	defer h.invalidateActions()
+	return h.update(func(tx Tx, lights LightTx) error {
+		if err := lights.Delete(lightId); err != nil {
+			return err
+		}
+		if actions := tx.Bucket("actions"); actions != nil {
+			if err := actions.Delete(lightId); err != nil {
+				return err
+			}
+		}
+		if err := removeGroupLight(tx, lightId); err != nil {
+			return err
+		}
+		return removeSceneLight(tx, lightId)
+	})
+}
+
+// GetStaged returns the lights waiting to be discovered by a search, keyed by name.
+func (h *HueApi) GetStaged() (map[string]*LightInfo, error) {
+	var result map[string]*LightInfo
+	err := h.store.View(func(tx Tx) (err error) {
+		result, err = readStaged(tx)
+		return err
+	})
+	return result, err
+}
+
+func readStaged(tx Tx) (map[string]*LightInfo, error) {
 	result := make(map[string]*LightInfo)
-	err := h.boltDb.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("lights"))
+	bucket := tx.Bucket("staged")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	err := bucket.ForEach(func(k string, v []byte) error {
+		light := &LightInfo{}
+		if err := json.Unmarshal(v, light); err != nil {
+			return err
+		}
+		result[k] = light
+		return nil
+	})
+	return result, err
+}
+
+// StageLight pre-registers a light that is added to the lights by the next search.
+func (h *HueApi) StageLight(light *LightInfo) error {
+	return h.update(func(tx Tx, lights LightTx) error {
+		existing, err := lights.Lights()
+		if err != nil {
+			return err
+		}
+		if err = checkName(existing, "", light.Name); err != nil {
+			return err
+		}
+		bucket := tx.Bucket("staged")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
+		}
+		if bucket.Get(light.Name) != nil {
+			return fmt.Errorf("staged light %s already exists", light.Name)
+		}
+		data, err := json.Marshal(light)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(light.Name, data)
+	})
+}
+
+func (h *HueApi) DeleteStaged(name string) error {
+	return h.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket("staged")
 		if bucket == nil {
 			return fmt.Errorf("bucket does not exist")
 		}
-		return bucket.ForEach(func(k, v []byte) error {
-			light := &LightInfo{}
-			if err := json.Unmarshal(v, light); err != nil {
+		if bucket.Get(name) == nil {
+			return fmt.Errorf("staged light %s not found", name)
+		}
+		return bucket.Delete(name)
+	})
+}
+
+// adoptStaged moves all staged lights to the lights and returns the names by new light id.
+func (h *HueApi) adoptStaged() (map[string]string, error) {
+	var adopted map[string]string
+	err := h.update(func(tx Tx, lights LightTx) error {
+		adopted = make(map[string]string)
+		staged, err := readStaged(tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedIds(staged) {
+			lightId, err := lights.Insert(staged[name])
+			if err != nil && strings.Contains(err.Error(), "already exists") {
+				// stays staged until the conflicting light is renamed
+				continue
+			}
+			if err != nil {
 				return err
 			}
-			result[string(k)] = light
-			return nil
+			if err = tx.Bucket("staged").Delete(name); err != nil {
+				return err
+			}
+			adopted[lightId] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adopted, nil
+}
+
+// ModifyLight reads the light, runs modify on it and stores the result atomically,
+// so concurrent modifications of a light cannot overwrite each other. An error returned by modify
+// leaves the light unchanged and is returned.
+func (h *HueApi) ModifyLight(lightId string, modify func(light *LightInfo) error) (*LightInfo, error) {
+	var result *LightInfo
+	err := h.update(func(_ Tx, lights LightTx) error {
+		modified, err := lights.Modify([]string{lightId}, func(_ string, light *LightInfo) error {
+			return modify(light)
 		})
+		result = modified[lightId]
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RenameLight changes the name of a light, the uniqueness of the name is checked atomically.
+func (h *HueApi) RenameLight(lightId string, name string) error {
+	return h.update(func(_ Tx, lights LightTx) error {
+		return lights.Rename(lightId, name)
+	})
+}
+
+// GetAction returns the action configured for the light or nil when there is none.
+func (h *HueApi) GetAction(lightId string) (*Action, error) {
+	var result *Action
+	err := h.store.View(func(tx Tx) error {
+		bucket := tx.Bucket("actions")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
+		}
+		v := bucket.Get(lightId)
+		if v == nil {
+			return nil
+		}
+		result = &Action{}
+		return json.Unmarshal(v, result)
 	})
 	return result, err
 }
 
-func (h *HueApi) GetLight(id string) (*LightInfo, error) {
-	result := new(LightInfo)
-	err := h.boltDb.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("lights"))
+// GetActions returns the actions of all lights by light id.
+func (h *HueApi) GetActions() (map[string]*Action, error) {
+	var result map[string]*Action
+	err := h.store.View(func(tx Tx) (err error) {
+		result, err = readActions(tx)
+		return err
+	})
+	return result, err
+}
+
+func (h *HueApi) PutAction(lightId string, action *Action) error {
+	defer h.invalidateActions()
+	return h.update(func(tx Tx, lights LightTx) error {
+		if _, err := lights.Light(lightId); err != nil {
+			return err
+		}
+		bucket := tx.Bucket("actions")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
+		}
+		data, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(lightId, data)
+	})
+}
+
+func (h *HueApi) DeleteAction(lightId string) error {
+	defer h.invalidateActions()
+	return h.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket("actions")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
+		}
+		return bucket.Delete(lightId)
+	})
+}
+
+// AddUser adds a new user for the device type to the whitelist and returns the generated username.
+func (h *HueApi) AddUser(deviceType string) (string, error) {
+	username, err := newUsername()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now().UTC().Format(hueTimeFormat)
+	entry := &WhitelistEntry{Name: deviceType, CreateDate: now, LastUseDate: now}
+	err = h.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket("whitelist")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
+		}
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(username, data)
+	})
+	return username, err
+}
+
+// GetUser returns the whitelist entry for username or nil when the user does not exist.
+func (h *HueApi) GetUser(username string) (*WhitelistEntry, error) {
+	var result *WhitelistEntry
+	err := h.store.View(func(tx Tx) error {
+		bucket := tx.Bucket("whitelist")
 		if bucket == nil {
 			return fmt.Errorf("bucket does not exist")
 		}
-		v := bucket.Get([]byte(id))
+		v := bucket.Get(username)
 		if v == nil {
-			return fmt.Errorf("light %s not found", id)
+			return nil
 		}
+		result = &WhitelistEntry{}
 		return json.Unmarshal(v, result)
 	})
 	return result, err
 }
 
-func (h *HueApi) PutLight(light *LightInfo) (*LightInfo, string, error) {
-	var lightId string
-	err := h.boltDb.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("lights"))
+func (h *HueApi) GetUsers() (map[string]*WhitelistEntry, error) {
+	var result map[string]*WhitelistEntry
+	err := h.store.View(func(tx Tx) (err error) {
+		result, err = readUsers(tx)
+		return err
+	})
+	return result, err
+}
+
+func readUsers(tx Tx) (map[string]*WhitelistEntry, error) {
+	result := make(map[string]*WhitelistEntry)
+	bucket := tx.Bucket("whitelist")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	err := bucket.ForEach(func(k string, v []byte) error {
+		entry := &WhitelistEntry{}
+		if err := json.Unmarshal(v, entry); err != nil {
+			return err
+		}
+		result[k] = entry
+		return nil
+	})
+	return result, err
+}
+
+// TouchUser sets the last use date of the user to now.
+func (h *HueApi) TouchUser(username string) error {
+	return h.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket("whitelist")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
+		}
+		v := bucket.Get(username)
+		if v == nil {
+			return fmt.Errorf("user %s not found", username)
+		}
+		entry := &WhitelistEntry{}
+		if err := json.Unmarshal(v, entry); err != nil {
+			return err
+		}
+		entry.LastUseDate = time.Now().UTC().Format(hueTimeFormat)
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(username, data)
+	})
+}
+
+func (h *HueApi) DeleteUser(username string) error {
+	return h.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket("whitelist")
 		if bucket == nil {
 			return fmt.Errorf("bucket does not exist")
 		}
+		if bucket.Get(username) == nil {
+			return fmt.Errorf("user %s not found", username)
+		}
+		return bucket.Delete(username)
+	})
+}
+
+// GetGroups returns all groups except the special group 0.
+func (h *HueApi) GetGroups() (map[string]*GroupInfo, error) {
+	var result map[string]*GroupInfo
+	err := h.view(func(tx Tx, lights LightTx) error {
+		all, err := lights.Lights()
+		if err != nil {
+			return err
+		}
+		result, err = readGroups(tx, all)
+		return err
+	})
+	return result, err
+}
+
+func (h *HueApi) GetGroup(id string) (*GroupInfo, error) {
+	var result *GroupInfo
+	err := h.view(func(tx Tx, lights LightTx) error {
+		all, err := lights.Lights()
+		if err != nil {
+			return err
+		}
+		result, err = readGroup(tx, id, all)
+		return err
+	})
+	return result, err
+}
+
+func readGroups(tx Tx, lights map[string]*LightInfo) (map[string]*GroupInfo, error) {
+	result := make(map[string]*GroupInfo)
+	bucket := tx.Bucket("groups")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	err := bucket.ForEach(func(k string, v []byte) error {
+		group := &GroupInfo{}
+		if err := json.Unmarshal(v, group); err != nil {
+			return err
+		}
+		group.updateState(lights)
+		result[k] = group
+		return nil
+	})
+	return result, err
+}
+
+func readGroup(tx Tx, id string, lights map[string]*LightInfo) (*GroupInfo, error) {
+	if id == allLightsGroup {
+		return newAllLightsGroup(lights), nil
+	}
+	bucket := tx.Bucket("groups")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	v := bucket.Get(id)
+	if v == nil {
+		return nil, fmt.Errorf("group %s not found", id)
+	}
+	group := &GroupInfo{}
+	if err := json.Unmarshal(v, group); err != nil {
+		return nil, err
+	}
+	group.updateState(lights)
+	return group, nil
+}
+
+func writeGroup(tx Tx, id string, group *GroupInfo) error {
+	bucket := tx.Bucket("groups")
+	if bucket == nil {
+		return fmt.Errorf("bucket does not exist")
+	}
+	data, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(id, data)
+}
 
-		// Check for duplicate names
-		nameExists := false
-		err := bucket.ForEach(func(k, v []byte) error {
-			existing := &LightInfo{}
-			if err := json.Unmarshal(v, existing); err != nil {
+// removeGroupLight removes a deleted light from all groups.
+func removeGroupLight(tx Tx, lightId string) error {
+	groups, err := readGroups(tx, nil)
+	if err != nil {
+		return err
+	}
+	for id, group := range groups {
+		if i := slices.Index(group.Lights, lightId); i >= 0 {
+			group.Lights = slices.Delete(group.Lights, i, i+1)
+			if err = writeGroup(tx, id, group); err != nil {
 				return err
 			}
-			if existing.Name == light.Name {
-				nameExists = true
-			}
-			return nil
-		})
+		}
+	}
+	return nil
+}
+
+func (h *HueApi) CreateGroup(change *GroupChange) (string, error) {
+	var groupId string
+	err := h.update(func(tx Tx, lightTx LightTx) error {
+		lights, err := lightTx.Lights()
 		if err != nil {
 			return err
 		}
-		if nameExists {
-			return fmt.Errorf("light with name %s already exists", light.Name)
+		bucket := tx.Bucket("groups")
+		if bucket == nil {
+			return fmt.Errorf("bucket does not exist")
 		}
 
-		// Generate unique ID starting from 1
 		for i := 1; ; i++ {
 			id := fmt.Sprintf("%d", i)
-			if bucket.Get([]byte(id)) == nil {
-				lightId = id
+			if bucket.Get(id) == nil {
+				groupId = id
 				break
 			}
 		}
 
-		light.Defaults(lightId)
+		group := &GroupInfo{Name: "Group " + groupId, Lights: []string{}}
+		if _, err := group.apply(groupId, change, lights); err != nil {
+			return err
+		}
+		if len(group.Lights) > 0 {
+			group.Action = lights[group.Lights[0]].State
+		}
+		return writeGroup(tx, groupId, group)
+	})
+	return groupId, err
+}
 
-		data, err := json.Marshal(light)
+func (h *HueApi) UpdateGroup(id string, change *GroupChange) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	if id == allLightsGroup {
+		return nil, NewError(ErrorGroupNotModifiable, "/groups/"+id)
+	}
+	err := h.update(func(tx Tx, lightTx LightTx) error {
+		lights, err := lightTx.Lights()
+		if err != nil {
+			return err
+		}
+		group, err := readGroup(tx, id, lights)
 		if err != nil {
 			return err
 		}
-		return bucket.Put([]byte(lightId), data)
+		if response, err = group.apply(id, change, lights); err != nil {
+			return err
+		}
+		return writeGroup(tx, id, group)
 	})
-	return light, lightId, err
+	return response, err
 }
 
-func (h *HueApi) DeleteLight(lightId string) error {
-	return h.boltDb.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("lights"))
+func (h *HueApi) DeleteGroup(id string) error {
+	return h.store.Update(func(tx Tx) error {
+		if id == allLightsGroup {
+			return NewError(ErrorGroupNotModifiable, "/groups/"+id)
+		}
+		bucket := tx.Bucket("groups")
 		if bucket == nil {
 			return fmt.Errorf("bucket does not exist")
 		}
-		if bucket.Get([]byte(lightId)) == nil {
-			return fmt.Errorf("light %s not found", lightId)
+		if bucket.Get(id) == nil {
+			return fmt.Errorf("group %s not found", id)
+		}
+		return bucket.Delete(id)
+	})
+}
+
+// ApplyGroupStateChange applies the change to all lights of the group atomically
+// and returns the response along with an event for every changed light.
+//
+// When the change recalls a scene the stored scene states of the group lights are applied first.
+func (h *HueApi) ApplyGroupStateChange(id string, change *StateChange) ([]map[string]interface{}, []*LightEvent, error) {
+	var response []map[string]interface{}
+	var events []*LightEvent
+	basePath := fmt.Sprintf("/groups/%s/action", id)
+	if err := change.Validate(basePath); err != nil {
+		return nil, nil, err
+	}
+	err := h.update(func(tx Tx, lightTx LightTx) error {
+		lights, err := lightTx.Lights()
+		if err != nil {
+			return err
+		}
+		group, err := readGroup(tx, id, lights)
+		if err != nil {
+			return err
+		}
+		changes := make(map[string]*StateChange)
+		if change.Scene != nil {
+			scene, err := readScene(tx, *change.Scene)
+			if err != nil {
+				if strings.Contains(err.Error(), "not found") {
+					return NewError(ErrorInvalidValue, basePath+"/scene", *change.Scene, "scene")
+				}
+				return err
+			}
+			for lightId, state := range scene.LightStates {
+				if slices.Contains(group.Lights, lightId) {
+					changes[lightId] = state.change()
+				}
+			}
+			response = append(response, map[string]interface{}{
+				"success": map[string]interface{}{basePath + "/scene": *change.Scene},
+			})
+		}
+
+		action := &LightInfo{State: group.Action}
+		response = append(response, action.applyStateChange(basePath, change)...)
+
+		_, err = lightTx.Modify(group.Lights, func(lightId string, light *LightInfo) error {
+			previous := light.State
+			// lights silently ignore the attributes their type does not support
+			profile := profileFor(light.Type)
+			filtered := profile.filter(change)
+			lightChange, applied := filtered, 0
+			if sceneChange, ok := changes[lightId]; ok {
+				sceneChange = profile.filter(sceneChange)
+				applied += len(light.ApplyStateChange(lightId, sceneChange))
+				lightChange = mergeStateChange(sceneChange, filtered)
+			}
+			if applied += len(light.ApplyStateChange(lightId, filtered)); applied > 0 {
+				events = append(events, &LightEvent{
+					ID: lightId, Light: light, State: light.State, Previous: previous, Change: lightChange,
+				})
+			}
+			return nil
+		})
+		if err != nil || id == allLightsGroup {
+			return err
+		}
+		group.Action = action.State
+		return writeGroup(tx, id, group)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return response, events, nil
+}
+
+func (h *HueApi) GetScenes() (map[string]*SceneInfo, error) {
+	result := make(map[string]*SceneInfo)
+	err := h.store.View(func(tx Tx) (err error) {
+		result, err = readScenes(tx)
+		return err
+	})
+	return result, err
+}
+
+func (h *HueApi) GetScene(id string) (*SceneInfo, error) {
+	var result *SceneInfo
+	err := h.store.View(func(tx Tx) (err error) {
+		result, err = readScene(tx, id)
+		return err
+	})
+	return result, err
+}
+
+func readScenes(tx Tx) (map[string]*SceneInfo, error) {
+	result := make(map[string]*SceneInfo)
+	bucket := tx.Bucket("scenes")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	err := bucket.ForEach(func(k string, v []byte) error {
+		scene := &SceneInfo{}
+		if err := json.Unmarshal(v, scene); err != nil {
+			return err
+		}
+		result[k] = scene
+		return nil
+	})
+	return result, err
+}
+
+func readScene(tx Tx, id string) (*SceneInfo, error) {
+	bucket := tx.Bucket("scenes")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	v := bucket.Get(id)
+	if v == nil {
+		return nil, fmt.Errorf("scene %s not found", id)
+	}
+	scene := &SceneInfo{}
+	return scene, json.Unmarshal(v, scene)
+}
+
+func writeScene(tx Tx, id string, scene *SceneInfo) error {
+	bucket := tx.Bucket("scenes")
+	if bucket == nil {
+		return fmt.Errorf("bucket does not exist")
+	}
+	data, err := json.Marshal(scene)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(id, data)
+}
+
+// removeSceneLight removes a deleted light from all scenes.
+func removeSceneLight(tx Tx, lightId string) error {
+	scenes, err := readScenes(tx)
+	if err != nil {
+		return err
+	}
+	for id, scene := range scenes {
+		if i := slices.Index(scene.Lights, lightId); i >= 0 {
+			scene.Lights = slices.Delete(scene.Lights, i, i+1)
+			delete(scene.LightStates, lightId)
+			if err = writeScene(tx, id, scene); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (h *HueApi) CreateScene(owner string, change *SceneChange) (string, error) {
+	sceneId, err := newSceneId()
+	if err != nil {
+		return "", err
+	}
+	err = h.update(func(tx Tx, lightTx LightTx) error {
+		lights, err := lightTx.Lights()
+		if err != nil {
+			return err
+		}
+		groups, err := readGroups(tx, lights)
+		if err != nil {
+			return err
+		}
+		groups[allLightsGroup] = newAllLightsGroup(lights)
+
+		scene := &SceneInfo{Owner: owner, Lights: []string{}, AppData: map[string]any{}}
+		if _, err = scene.apply(sceneId, change, lights, groups); err != nil {
+			return err
+		}
+		return writeScene(tx, sceneId, scene)
+	})
+	return sceneId, err
+}
+
+func (h *HueApi) UpdateScene(id string, change *SceneChange) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	err := h.update(func(tx Tx, lightTx LightTx) error {
+		lights, err := lightTx.Lights()
+		if err != nil {
+			return err
+		}
+		scene, err := readScene(tx, id)
+		if err != nil {
+			return err
+		}
+		if response, err = scene.apply(id, change, lights, nil); err != nil {
+			return err
+		}
+		return writeScene(tx, id, scene)
+	})
+	return response, err
+}
+
+func (h *HueApi) UpdateSceneLightState(id, lightId string, change *StateChange) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	err := h.update(func(tx Tx, lightTx LightTx) error {
+		scene, err := readScene(tx, id)
+		if err != nil {
+			return err
+		}
+		if _, ok := scene.LightStates[lightId]; !ok {
+			return fmt.Errorf("scene %s light %s not found", id, lightId)
+		}
+		light, err := lightTx.Light(lightId)
+		if err != nil {
+			return err
+		}
+		if response, err = scene.applyLightState(id, lightId, light, change); err != nil {
+			return err
 		}
-		return bucket.Delete([]byte(lightId))
+		scene.LastUpdated = time.Now().UTC().Format(hueTimeFormat)
+		return writeScene(tx, id, scene)
 	})
+	return response, err
 }
 
-func (h *HueApi) UpdateLight(lightId string, light *LightInfo) error {
-	return h.boltDb.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket([]byte("lights"))
+func (h *HueApi) DeleteScene(id string) error {
+	return h.store.Update(func(tx Tx) error {
+		bucket := tx.Bucket("scenes")
 		if bucket == nil {
 			return fmt.Errorf("bucket does not exist")
 		}
-		if bucket.Get([]byte(lightId)) == nil {
-			return fmt.Errorf("light %s not found", lightId)
+		if bucket.Get(id) == nil {
+			return fmt.Errorf("scene %s not found", id)
+		}
+		return bucket.Delete(id)
+	})
+}
+
+// GetSettings returns the persisted bridge settings or the defaults when none are stored.
+func (h *HueApi) GetSettings() (*BridgeSettings, error) {
+	var result *BridgeSettings
+	err := h.store.View(func(tx Tx) (err error) {
+		result, err = readSettings(tx)
+		return err
+	})
+	return result, err
+}
+
+func readSettings(tx Tx) (*BridgeSettings, error) {
+	bucket := tx.Bucket("config")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	settings := DefaultBridgeSettings()
+	v := bucket.Get("settings")
+	if v == nil {
+		return settings, nil
+	}
+	return settings, json.Unmarshal(v, settings)
+}
+
+func (h *HueApi) UpdateSettings(change *ConfigChange) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	err := h.store.Update(func(tx Tx) error {
+		settings, err := readSettings(tx)
+		if err != nil {
+			return err
+		}
+		if response, err = settings.apply(change); err != nil {
+			return err
+		}
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket("config").Put("settings", data)
+	})
+	return response, err
+}
+
+// GetDatastore reads all resources in a single transaction so the result is a consistent snapshot.
+func (h *HueApi) GetDatastore() (*Datastore, error) {
+	result := &Datastore{
+		Schedules:     map[string]any{},
+		Rules:         map[string]any{},
+		Sensors:       map[string]any{},
+		ResourceLinks: map[string]any{},
+	}
+	err := h.view(func(tx Tx, lights LightTx) (err error) {
+		if result.Lights, err = lights.Lights(); err != nil {
+			return err
+		}
+		if result.Groups, err = readGroups(tx, result.Lights); err != nil {
+			return err
+		}
+		if result.Scenes, err = readScenes(tx); err != nil {
+			return err
+		}
+		for _, scene := range result.Scenes {
+			scene.LightStates = nil
 		}
-		jsonData, err := json.Marshal(light)
+		settings, err := readSettings(tx)
 		if err != nil {
 			return err
 		}
-		return bucket.Put([]byte(lightId), jsonData)
+		users, err := readUsers(tx)
+		if err != nil {
+			return err
+		}
+		result.Config = h.fullConfig(settings, users)
+		return nil
 	})
+	return result, err
 }
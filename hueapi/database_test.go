@@ -1,52 +1,28 @@
 package hueapi
 
 import (
-	"os"
-	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"go.etcd.io/bbolt"
 )
 
-func setupTestDB(t *testing.T) (*HueApi, string) {
-	// Create a temporary directory for the test database
-	tmpDir, err := os.MkdirTemp("", "hueapi-test-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp directory: %v", err)
+func setupTestDB(t *testing.T) *HueApi {
+	h := &HueApi{logger: &testLogger{t}, store: NewMemoryStore()}
+	if err := h.SetupBolt(); err != nil {
+		t.Fatalf("Failed to setup store: %v", err)
 	}
-
-	dbPath := filepath.Join(tmpDir, "test.db")
-	db, err := bbolt.Open(dbPath, 0600, nil)
-	if err != nil {
-		os.RemoveAll(tmpDir)
-		t.Fatalf("Failed to open test database: %v", err)
-	}
-
-	h := &HueApi{boltDb: db}
-	err = h.SetupBolt()
-	if err != nil {
-		db.Close()
-		os.RemoveAll(tmpDir)
-		t.Fatalf("Failed to setup bolt DB: %v", err)
-	}
-
-	return h, tmpDir
-}
-
-func teardownTestDB(h *HueApi, tmpDir string) {
-	if h.boltDb != nil {
-		h.boltDb.Close()
-	}
-	os.RemoveAll(tmpDir)
+	t.Cleanup(h.Shutdown)
+	return h
 }
 
 func TestSetupBolt(t *testing.T) {
-	h, tmpDir := setupTestDB(t)
-	defer teardownTestDB(h, tmpDir)
+	h, db := openTestDB(t)
+	assert.NoError(t, h.SetupBolt())
 
 	// Verify the lights bucket exists
-	err := h.boltDb.View(func(tx *bbolt.Tx) error {
+	err := db.View(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte("lights"))
 		if bucket == nil {
 			t.Error("Lights bucket was not created")
@@ -57,8 +33,7 @@ func TestSetupBolt(t *testing.T) {
 }
 
 func TestPutAndGetLight(t *testing.T) {
-	h, tmpDir := setupTestDB(t)
-	defer teardownTestDB(h, tmpDir)
+	h := setupTestDB(t)
 
 	// Test putting a new light
 	light := &LightInfo{
@@ -87,9 +62,23 @@ func TestPutAndGetLight(t *testing.T) {
 
 }
 
+func TestDeletedLightIdNotReused(t *testing.T) {
+	h := setupTestDB(t)
+
+	for _, name := range []string{"Lamp", "Desk"} {
+		_, _, err := h.PutLight(&LightInfo{Name: name})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, h.DeleteLight("2"))
+
+	light, lightId, err := h.PutLight(&LightInfo{Name: "Porch"})
+	assert.NoError(t, err)
+	assert.Equal(t, "3", lightId)
+	assert.Equal(t, "00:17:88:01:00:bd:c7:b9-03", light.UniqueID)
+}
+
 func TestGetNonExistentLight(t *testing.T) {
-	h, tmpDir := setupTestDB(t)
-	defer teardownTestDB(h, tmpDir)
+	h := setupTestDB(t)
 
 	_, err := h.GetLight("nonexistent")
 	assert.Error(t, err)
@@ -97,8 +86,7 @@ func TestGetNonExistentLight(t *testing.T) {
 }
 
 func TestPutLightWithDuplicateName(t *testing.T) {
-	h, tmpDir := setupTestDB(t)
-	defer teardownTestDB(h, tmpDir)
+	h := setupTestDB(t)
 
 	light1 := &LightInfo{
 		Name: "Test Light",
@@ -119,8 +107,7 @@ func TestPutLightWithDuplicateName(t *testing.T) {
 }
 
 func TestGetLights(t *testing.T) {
-	h, tmpDir := setupTestDB(t)
-	defer teardownTestDB(h, tmpDir)
+	h := setupTestDB(t)
 
 	// Add multiple lights
 	lights := []*LightInfo{
@@ -141,7 +128,8 @@ func TestGetLights(t *testing.T) {
 
 	// Verify all lights are present with correct IDs
 	lightsMap := make(map[string]*LightInfo)
-	for id, light := range allLights {
+	for _, id := range sortedIds(allLights) {
+		light := allLights[id]
 		lightsMap[light.Name] = light
 		expectedId := string(rune('0' + len(lightsMap))) // Convert number to string
 		assert.Equal(t, expectedId, id, "Light %s should have ID %s", light.Name, expectedId)
@@ -151,3 +139,28 @@ func TestGetLights(t *testing.T) {
 		assert.NotNil(t, lightsMap[light.Name], "Light %s should be present in results", light.Name)
 	}
 }
+
+func TestModifyLightConcurrent(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"hue":0,"sat":100}`)
+
+	const workers, changes = 8, 25
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < changes; j++ {
+				request(h, "PUT", "/api/"+user+"/lights/1/state", `{"hue_inc":1}`)
+			}
+		}()
+	}
+	wg.Wait()
+
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	// every increment is applied to the result of the previous one
+	assert.Equal(t, uint16(workers*changes), light.State.Hue)
+}
@@ -0,0 +1,34 @@
+package hueapi
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Datastore is the complete bridge state returned by GET /api/<username>.
+type Datastore struct {
+	Lights        map[string]*LightInfo `json:"lights"`
+	Groups        map[string]*GroupInfo `json:"groups"`
+	Config        *BridgeConfig         `json:"config"`
+	Schedules     map[string]any        `json:"schedules"`
+	Scenes        map[string]*SceneInfo `json:"scenes"`
+	Rules         map[string]any        `json:"rules"`
+	Sensors       map[string]any        `json:"sensors"`
+	ResourceLinks map[string]any        `json:"resourcelinks"`
+}
+
+func (h *HueApi) FullState(c *gin.Context) {
+	datastore, err := h.GetDatastore()
+	if err != nil {
+		abortWithError(c, "/", err)
+		return
+	}
+	for id, light := range datastore.Lights {
+		light.State = h.currentState(id, light.State)
+	}
+	// the lights are reported in their API view
+	c.JSON(http.StatusOK, struct {
+		*Datastore
+		Lights map[string]*lightView `json:"lights"`
+	}{datastore, lightViews(datastore.Lights)})
+}
@@ -0,0 +1,35 @@
+package hueapi
+
+import (
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullState(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall")
+	_, err := h.CreateGroup(&GroupChange{Lights: []string{"1", "2"}})
+	assert.NoError(t, err)
+	name := "Evening"
+	_, err = h.CreateScene(user, &SceneChange{Name: &name, Lights: []string{"1"}})
+	assert.NoError(t, err)
+
+	datastore := map[string]map[string]any{}
+	assert.NoError(t, json.Unmarshal(request(h, "GET", "/api/"+user, "").Body.Bytes(), &datastore))
+	for _, resource := range []string{"lights", "groups", "config", "schedules", "scenes", "rules", "sensors", "resourcelinks"} {
+		assert.Contains(t, datastore, resource)
+	}
+	assert.Len(t, datastore["lights"], 2)
+	assert.Contains(t, datastore["lights"]["1"], "capabilities")
+	assert.Len(t, datastore["groups"], 1)
+	assert.Len(t, datastore["scenes"], 1)
+	assert.Contains(t, datastore["config"]["whitelist"], user)
+
+	errs := hueErrors(t, request(h, "GET", "/api/nobody", ""))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorUnauthorizedUser, errs[0].Type)
+	}
+}
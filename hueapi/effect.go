@@ -0,0 +1,196 @@
+package hueapi
+
+import (
+	"errors"
+	"go.etcd.io/bbolt"
+	"strings"
+	"time"
+)
+
+const (
+	EffectNone      = "none"
+	EffectColorLoop = "colorloop"
+
+	AlertNone    = "none"
+	AlertSelect  = "select"
+	AlertLSelect = "lselect"
+)
+
+const (
+	// colorloopCycle is the time the colorloop effect takes to cycle through all hues.
+	colorloopCycle = 20 * time.Second
+	colorloopTick  = 500 * time.Millisecond
+
+	// selectDuration is a single breathe cycle, lselectDuration keeps breathing for 15 seconds.
+	selectDuration  = time.Second
+	lselectDuration = 15 * time.Second
+)
+
+// colorloop cycles the hue of a light, starting from its hue when the effect was set.
+type colorloop struct {
+	hue   uint16
+	start time.Time
+	stop  chan struct{}
+}
+
+// at returns state with the hue of the colorloop at time now.
+func (c *colorloop) at(now time.Time, state LightState) LightState {
+	progress := float64(now.Sub(c.start)%colorloopCycle) / float64(colorloopCycle)
+	state.Hue = uint16((int(c.hue) + int(progress*65536)) % 65536)
+	state.ColorMode = "hs"
+	return state
+}
+
+// startEffect starts or stops the colorloop and the alert of a change.
+func (h *HueApi) startEffect(e *LightEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown || e.Change == nil {
+		return
+	}
+
+	if e.Change.Effect != nil {
+		if running, ok := h.colorloops[e.ID]; ok {
+			close(running.stop)
+			delete(h.colorloops, e.ID)
+		}
+		if *e.Change.Effect == EffectColorLoop {
+			c := &colorloop{hue: e.State.Hue, start: time.Now(), stop: make(chan struct{})}
+			if h.colorloops == nil {
+				h.colorloops = make(map[string]*colorloop)
+			}
+			h.colorloops[e.ID] = c
+			h.running.Add(1)
+			go h.runColorloop(e.ID, c)
+		}
+	}
+
+	if e.Change.Alert != nil {
+		if timer, ok := h.alerts[e.ID]; ok {
+			timer.Stop()
+			delete(h.alerts, e.ID)
+		}
+		var duration time.Duration
+		switch *e.Change.Alert {
+		case AlertSelect:
+			duration = selectDuration
+		case AlertLSelect:
+			duration = lselectDuration
+		default:
+			return
+		}
+		if h.alerts == nil {
+			h.alerts = make(map[string]*time.Timer)
+		}
+		id, alert := e.ID, *e.Change.Alert
+		var timer *time.Timer
+		timer = time.AfterFunc(duration, func() {
+			h.mu.Lock()
+			active := h.alerts[id] == timer
+			if active {
+				delete(h.alerts, id)
+			}
+			h.mu.Unlock()
+			if active {
+				h.resetAlert(id, alert)
+			}
+		})
+		h.alerts[id] = timer
+	}
+}
+
+func (h *HueApi) runColorloop(id string, c *colorloop) {
+	defer h.running.Done()
+	ticker := time.NewTicker(colorloopTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			light, err := h.GetLight(id)
+			if err != nil {
+				h.cancelEffects(id)
+				return
+			}
+			h.mu.Lock()
+			active := h.colorloops[id] == c
+			h.mu.Unlock()
+			if !active {
+				return
+			}
+			previous := light.State
+			light.State = c.at(now, light.State)
+			h.notify(&LightEvent{ID: id, Light: light, State: light.State, Previous: previous, Effect: true})
+		}
+	}
+}
+
+// errAlertChanged aborts resetting an alert that was changed in the meantime.
+var errAlertChanged = errors.New("alert changed")
+
+// resetAlert sets the alert of a light back to none once the alert has finished.
+func (h *HueApi) resetAlert(id string, alert string) {
+	var previous LightState
+	none := AlertNone
+	change := &StateChange{Alert: &none}
+	light, err := h.ModifyLight(id, func(light *LightInfo) error {
+		if light.State.Alert != alert {
+			return errAlertChanged
+		}
+		previous = light.State
+		light.ApplyStateChange(id, change)
+		return nil
+	})
+	if err != nil {
+		// the light was changed, deleted or the database closed before the alert finished
+		if !errors.Is(err, errAlertChanged) && !errors.Is(err, bbolt.ErrDatabaseNotOpen) &&
+			!strings.Contains(err.Error(), "not found") {
+			h.logger.Errorf("reset alert of light %s: %v", id, err)
+		}
+		return
+	}
+	// notify directly, a running transition or colorloop continues
+	h.notify(&LightEvent{ID: id, Light: light, State: light.State, Previous: previous, Change: change})
+}
+
+// cancelEffects stops a running colorloop and alert of the light.
+func (h *HueApi) cancelEffects(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if running, ok := h.colorloops[id]; ok {
+		close(running.stop)
+		delete(h.colorloops, id)
+	}
+	if timer, ok := h.alerts[id]; ok {
+		timer.Stop()
+		delete(h.alerts, id)
+	}
+}
+
+// Shutdown stops all transitions, colorloops, alerts and action retries and waits for their
+// goroutines to exit, no new ones are started afterwards.
+func (h *HueApi) Shutdown() {
+	h.mu.Lock()
+	h.shutdown = true
+	for id, running := range h.transitions {
+		close(running.stop)
+		delete(h.transitions, id)
+	}
+	for id, running := range h.colorloops {
+		close(running.stop)
+		delete(h.colorloops, id)
+	}
+	for id, timer := range h.alerts {
+		timer.Stop()
+		delete(h.alerts, id)
+	}
+	for _, w := range h.actionWorkers {
+		select {
+		case w.signal <- struct{}{}:
+		default:
+		}
+	}
+	h.mu.Unlock()
+	h.running.Wait()
+}
@@ -0,0 +1,145 @@
+package hueapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// https://developers.meethue.com/develop/hue-api/error-messages/
+
+type ErrorType int
+
+const (
+	ErrorUnauthorizedUser         ErrorType = 1
+	ErrorInvalidJSON              ErrorType = 2
+	ErrorResourceNotAvailable     ErrorType = 3
+	ErrorMethodNotAvailable       ErrorType = 4
+	ErrorMissingParameters        ErrorType = 5
+	ErrorParameterNotAvailable    ErrorType = 6
+	ErrorInvalidValue             ErrorType = 7
+	ErrorParameterNotModifiable   ErrorType = 8
+	ErrorTooManyItems             ErrorType = 11
+	ErrorPortalConnectionRequired ErrorType = 12
+	ErrorLinkButtonNotPressed     ErrorType = 101
+	ErrorDeviceIsOff              ErrorType = 201
+	ErrorGroupTableFull           ErrorType = 301
+	ErrorDeviceGroupTableFull     ErrorType = 302
+	ErrorGroupNotModifiable       ErrorType = 305
+	ErrorSceneCreationInProgress  ErrorType = 402
+	ErrorSceneBufferFull          ErrorType = 403
+	ErrorInternal                 ErrorType = 901
+)
+
+var errorDescriptions = map[ErrorType]string{
+	ErrorUnauthorizedUser:         "unauthorized user",
+	ErrorInvalidJSON:              "body contains invalid json",
+	ErrorResourceNotAvailable:     "resource, %s, not available",
+	ErrorMethodNotAvailable:       "method, %s, not available for resource, %s",
+	ErrorMissingParameters:        "missing parameters in body",
+	ErrorParameterNotAvailable:    "parameter, %s, not available",
+	ErrorInvalidValue:             "invalid value, %s, for parameter, %s",
+	ErrorParameterNotModifiable:   "parameter, %s, is not modifiable",
+	ErrorTooManyItems:             "too many items in list",
+	ErrorPortalConnectionRequired: "Portal connection required",
+	ErrorLinkButtonNotPressed:     "link button not pressed",
+	ErrorDeviceIsOff:              "parameter, %s, is not modifiable. Device is set to off.",
+	ErrorGroupTableFull:           "group could not be created. Group table is full.",
+	ErrorDeviceGroupTableFull:     "device, %s, could not be added to group. Group table is full.",
+	ErrorGroupNotModifiable:       "It is not allowed to update or delete group of this type",
+	ErrorSceneCreationInProgress:  "Scene could not be created. Scene creation in progress.",
+	ErrorSceneBufferFull:          "Scene could not be created. Scene buffer in bridge full",
+	ErrorInternal:                 "Internal error, %s",
+}
+
+// HueError is a single entry of a Hue api error response.
+type HueError struct {
+	Type        ErrorType `json:"type"`
+	Address     string    `json:"address"`
+	Description string    `json:"description"`
+}
+
+type ErrorResponse struct {
+	Error *HueError `json:"error"`
+}
+
+// NewError creates a HueError with the catalogue description for the type formatted with args.
+func NewError(errorType ErrorType, address string, args ...any) *HueError {
+	description, ok := errorDescriptions[errorType]
+	if !ok {
+		description = "unknown error"
+	}
+	if len(args) > 0 {
+		description = fmt.Sprintf(description, args...)
+	}
+	return &HueError{Type: errorType, Address: address, Description: description}
+}
+
+func (e *HueError) Error() string {
+	return fmt.Sprintf("hue error %d at %s: %s", e.Type, e.Address, e.Description)
+}
+
+// abortWithErrors responds with the Hue error array, Hue clients expect status 200 for errors.
+func abortWithErrors(c *gin.Context, errs ...*HueError) {
+	response := make([]ErrorResponse, len(errs))
+	for i, err := range errs {
+		response[i].Error = err
+		_ = c.Error(err)
+	}
+	c.AbortWithStatusJSON(http.StatusOK, response)
+}
+
+// abortWithError converts err to a HueError for the resource at address.
+func abortWithError(c *gin.Context, address string, err error) {
+	var hueError *HueError
+	switch {
+	case errors.As(err, &hueError):
+	case strings.Contains(err.Error(), "not found"):
+		hueError = NewError(ErrorResourceNotAvailable, address, address)
+	default:
+		hueError = NewError(ErrorInternal, address, err.Error())
+	}
+	abortWithErrors(c, hueError)
+}
+
+// bindError converts a request binding error for the resource at address to a HueError.
+func bindError(address string, err error) *HueError {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		value := strings.TrimPrefix(typeError.Value, "number ")
+		return NewError(ErrorInvalidValue, address+"/"+typeError.Field, value, typeError.Field)
+	}
+	return NewError(ErrorInvalidJSON, address)
+}
+
+// NoRoute responds with resource not available for unknown /api paths.
+func (h *HueApi) NoRoute(c *gin.Context) {
+	if !strings.HasPrefix(c.Request.URL.Path, "/api") {
+		c.AbortWithStatus(http.StatusNotFound)
+		return
+	}
+	address := apiAddress(c.Request.URL.Path)
+	abortWithErrors(c, NewError(ErrorResourceNotAvailable, address, address))
+}
+
+// NoMethod responds with method not available for known /api paths.
+func (h *HueApi) NoMethod(c *gin.Context) {
+	if !strings.HasPrefix(c.Request.URL.Path, "/api") {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+	address := apiAddress(c.Request.URL.Path)
+	abortWithErrors(c, NewError(ErrorMethodNotAvailable, address, c.Request.Method, address))
+}
+
+// apiAddress strips the /api/<user> prefix from a request path.
+func apiAddress(path string) string {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 3)
+	if len(parts) < 3 {
+		return "/"
+	}
+	return "/" + parts[2]
+}
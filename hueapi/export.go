@@ -0,0 +1,410 @@
+package hueapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// ExportVersion is the version of the export document written by this build.
+const ExportVersion = 1
+
+// BridgeIdentity is what apps recognize the bridge by, it has to move along with the configuration.
+type BridgeIdentity struct {
+	SerialNumber string `json:"serialnumber"`
+	UUID         string `json:"uuid"`
+}
+
+type BridgeExport struct {
+	BridgeIdentity
+	Settings *BridgeSettings `json:"settings"`
+}
+
+// Export is the whole bridge configuration, lights keep their ids and uniqueids.
+type Export struct {
+	Version int                        `json:"version"`
+	Bridge  BridgeExport               `json:"bridge"`
+	Lights  map[string]*LightInfo      `json:"lights"`
+	Actions map[string]*Action         `json:"actions"`
+	Users   map[string]*WhitelistEntry `json:"users"`
+	Groups  map[string]*GroupInfo      `json:"groups"`
+	Scenes  map[string]*SceneInfo      `json:"scenes"`
+}
+
+// Diff lists the ids of a section which an import adds, removes or changes.
+type Diff struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// ParseExport decodes an export document, YAML being a superset of JSON both are accepted.
+func ParseExport(data []byte) (*Export, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(stringKeys(doc))
+	if err != nil {
+		return nil, err
+	}
+	result := &Export{}
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// stringKeys converts the keys of yaml maps, like unquoted light ids, to strings.
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = stringKeys(value)
+		}
+		return v
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, value := range v {
+			result[fmt.Sprint(key)] = stringKeys(value)
+		}
+		return result
+	case []any:
+		for i, value := range v {
+			v[i] = stringKeys(value)
+		}
+	}
+	return v
+}
+
+// YAML encodes the document as YAML with the same field names as JSON.
+func (e *Export) YAML() ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(doc)
+}
+
+// Validate checks the document is complete and its references are consistent.
+func (e *Export) Validate() error {
+	if e.Version < 1 || e.Version > ExportVersion {
+		return fmt.Errorf("unsupported export version %d", e.Version)
+	}
+	if e.Bridge.Settings == nil {
+		return fmt.Errorf("bridge settings are required")
+	}
+	for id, light := range e.Lights {
+		if light.Name == "" {
+			return fmt.Errorf("light %s: name is required", id)
+		}
+		if err := checkName(e.Lights, id, light.Name); err != nil {
+			return err
+		}
+		if _, ok := ProfileFor(light.Type); !ok {
+			return fmt.Errorf("light %s: unknown light type %s", id, light.Type)
+		}
+	}
+	for id, action := range e.Actions {
+		if _, ok := e.Lights[id]; !ok {
+			return fmt.Errorf("action for light %s not found", id)
+		}
+		if err := action.Validate(); err != nil {
+			return fmt.Errorf("action for light %s: %w", id, err)
+		}
+	}
+	for id, group := range e.Groups {
+		if id == allLightsGroup {
+			return fmt.Errorf("group %s is not modifiable", id)
+		}
+		if !slices.Contains(groupTypes, group.Type) {
+			return fmt.Errorf("group %s: invalid type %s", id, group.Type)
+		}
+		for _, lightId := range group.Lights {
+			if _, ok := e.Lights[lightId]; !ok {
+				return fmt.Errorf("group %s: light %s not found", id, lightId)
+			}
+		}
+	}
+	for id, scene := range e.Scenes {
+		for _, lightId := range scene.Lights {
+			if _, ok := e.Lights[lightId]; !ok {
+				return fmt.Errorf("scene %s: light %s not found", id, lightId)
+			}
+		}
+		// group 0 is implicit and never exported
+		if _, ok := e.Groups[scene.Group]; scene.Group != "" && scene.Group != allLightsGroup && !ok {
+			return fmt.Errorf("scene %s: group %s not found", id, scene.Group)
+		}
+		for lightId := range scene.LightStates {
+			if _, ok := e.Lights[lightId]; !ok {
+				return fmt.Errorf("scene %s: lightstate of light %s not found", id, lightId)
+			}
+		}
+	}
+	return nil
+}
+
+// diff compares the JSON objects of current and imported by their keys.
+func diff(current, imported any) (*Diff, error) {
+	var objects [2]map[string]json.RawMessage
+	for i, v := range []any{current, imported} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &objects[i]); err != nil {
+			return nil, err
+		}
+	}
+	result := &Diff{}
+	for _, key := range sortedIds(objects[1]) {
+		value, ok := objects[0][key]
+		switch {
+		case !ok:
+			result.Added = append(result.Added, key)
+		case !bytes.Equal(value, objects[1][key]):
+			result.Changed = append(result.Changed, key)
+		}
+	}
+	for _, key := range sortedIds(objects[0]) {
+		if _, ok := objects[1][key]; !ok {
+			result.Removed = append(result.Removed, key)
+		}
+	}
+	return result, nil
+}
+
+func readIdentity(tx Tx) (*BridgeIdentity, error) {
+	bucket := tx.Bucket("config")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	v := bucket.Get("identity")
+	if v == nil {
+		return nil, nil
+	}
+	identity := &BridgeIdentity{}
+	return identity, json.Unmarshal(v, identity)
+}
+
+// loadIdentity replaces the identity of the first bridge with an imported one.
+func (h *HueApi) loadIdentity() error {
+	if len(h.bridges) == 0 {
+		return nil
+	}
+	return h.store.View(func(tx Tx) error {
+		identity, err := readIdentity(tx)
+		if identity != nil {
+			h.bridges[0].SerialNumber = identity.SerialNumber
+			h.bridges[0].UUID = identity.UUID
+			h.bridges[0].Location = h.deviceLocation(identity.SerialNumber)
+		}
+		return err
+	})
+}
+
+func readActions(tx Tx) (map[string]*Action, error) {
+	result := make(map[string]*Action)
+	bucket := tx.Bucket("actions")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	err := bucket.ForEach(func(k string, v []byte) error {
+		action := &Action{}
+		if err := json.Unmarshal(v, action); err != nil {
+			return err
+		}
+		result[k] = action
+		return nil
+	})
+	return result, err
+}
+
+// replaceBucket replaces the contents of the bucket name with only items.
+func replaceBucket[T any](tx Tx, name string, items map[string]T) error {
+	if err := clearBucket(tx, name); err != nil {
+		return err
+	}
+	bucket := tx.Bucket(name)
+	for id, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if err = bucket.Put(id, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Export returns the whole bridge configuration.
+func (h *HueApi) Export() (*Export, error) {
+	var result *Export
+	err := h.view(func(tx Tx, lights LightTx) (err error) {
+		result, err = h.readExport(tx, lights)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (h *HueApi) readExport(tx Tx, lights LightTx) (result *Export, err error) {
+	result = &Export{Version: ExportVersion}
+	if result.Lights, err = lights.Lights(); err != nil {
+		return nil, err
+	}
+	if result.Actions, err = readActions(tx); err != nil {
+		return nil, err
+	}
+	if result.Users, err = readUsers(tx); err != nil {
+		return nil, err
+	}
+	if result.Groups, err = readGroups(tx, result.Lights); err != nil {
+		return nil, err
+	}
+	if result.Scenes, err = readScenes(tx); err != nil {
+		return nil, err
+	}
+	if result.Bridge.Settings, err = readSettings(tx); err != nil {
+		return nil, err
+	}
+	identity, err := readIdentity(tx)
+	switch {
+	case identity != nil:
+		result.Bridge.BridgeIdentity = *identity
+	case len(h.bridges) > 0:
+		result.Bridge.SerialNumber = h.bridges[0].SerialNumber
+		result.Bridge.UUID = h.bridges[0].UUID
+	}
+	return result, err
+}
+
+// ErrInvalidExport is wrapped by the errors Import returns for an export failing validation.
+var ErrInvalidExport = errors.New("invalid export")
+
+// Import replaces the whole bridge configuration with export in a single transaction and returns
+// what changed per section. With dryRun nothing is changed. A changed bridge identity takes effect
+// after a restart.
+func (h *HueApi) Import(export *Export, dryRun bool) (map[string]*Diff, error) {
+	if err := export.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidExport, err)
+	}
+	run := h.update
+	if dryRun {
+		run = h.view
+	}
+	var current *Export
+	result := make(map[string]*Diff)
+	err := run(func(tx Tx, lights LightTx) (err error) {
+		if current, err = h.readExport(tx, lights); err != nil {
+			return err
+		}
+		for name, sections := range map[string][2]any{
+			"bridge":  {current.Bridge, export.Bridge},
+			"lights":  {current.Lights, export.Lights},
+			"actions": {current.Actions, export.Actions},
+			"users":   {current.Users, export.Users},
+			"groups":  {current.Groups, export.Groups},
+			"scenes":  {current.Scenes, export.Scenes},
+		} {
+			if result[name], err = diff(sections[0], sections[1]); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return nil
+		}
+
+		if err = lights.Replace(export.Lights); err != nil {
+			return err
+		}
+		if err = replaceBucket(tx, "actions", export.Actions); err != nil {
+			return err
+		}
+		if err = replaceBucket(tx, "whitelist", export.Users); err != nil {
+			return err
+		}
+		if err = replaceBucket(tx, "groups", export.Groups); err != nil {
+			return err
+		}
+		if err = replaceBucket(tx, "scenes", export.Scenes); err != nil {
+			return err
+		}
+		config := map[string]any{"settings": export.Bridge.Settings}
+		if export.Bridge.SerialNumber != "" {
+			config["identity"] = export.Bridge.BridgeIdentity
+		}
+		return replaceBucket(tx, "config", config)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	h.invalidateActions()
+	for id := range current.Lights {
+		h.cancelTransition(id)
+		h.cancelEffects(id)
+	}
+	if len(result["bridge"].Changed) > 0 {
+		h.logger.Infof("bridge configuration imported, restart to apply the bridge identity")
+	}
+	return result, nil
+}
+
+func (h *HueApi) AdminExport(c *gin.Context) {
+	export, err := h.Export()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if c.Query("format") == "yaml" {
+		data, err := export.YAML()
+		if err != nil {
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		c.Data(http.StatusOK, "application/yaml; charset=utf-8", data)
+		return
+	}
+	c.JSON(http.StatusOK, export)
+}
+
+func (h *HueApi) AdminImport(c *gin.Context) {
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	export, err := ParseExport(data)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := h.Import(export, c.Query("dryrun") == "true")
+	if errors.Is(err, ErrInvalidExport) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
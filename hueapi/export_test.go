@@ -0,0 +1,178 @@
+package hueapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mlctrez/ehugo/ssdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportJSON(t *testing.T, h *HueApi) string {
+	export, err := h.Export()
+	require.NoError(t, err)
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestExportImport(t *testing.T) {
+	h := setupTestApi(t)
+	h.bridges = []*ssdp.BridgeInfo{{SerialNumber: "001788FFFE23BFC1", UUID: "2f402f80-da50-11e1-9b23-001788255acc"}}
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall", "Porch")
+	require.NoError(t, h.DeleteLight("2"))
+	request(h, "PUT", "/api/"+user+"/lights/3/state", `{"bri":20}`)
+	request(h, "POST", "/api/"+user+"/groups", `{"name":"Downstairs","type":"Room","lights":["1","3"]}`)
+	request(h, "POST", "/api/"+user+"/scenes", `{"name":"Evening","lights":["1"]}`)
+	require.NoError(t, h.PutAction("1", &Action{URL: "http://localhost/kitchen"}))
+
+	// the yaml document decodes to the same configuration
+	export, err := h.Export()
+	require.NoError(t, err)
+	data, err := export.YAML()
+	require.NoError(t, err)
+	parsed, err := ParseExport(data)
+	require.NoError(t, err)
+	expected := exportJSON(t, h)
+	actual, err := json.Marshal(parsed)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, string(actual))
+
+	target := setupTestApi(t)
+	createLights(t, target, "Old")
+
+	result, err := target.Import(parsed, true)
+	require.NoError(t, err)
+	assert.Equal(t, &Diff{Added: []string{"3"}, Changed: []string{"1"}}, result["lights"])
+	assert.Equal(t, []string{"serialnumber", "uuid"}, result["bridge"].Changed)
+	assert.Len(t, result["scenes"].Added, 1)
+	light, err := target.GetLight("1")
+	require.NoError(t, err)
+	assert.Equal(t, "Old", light.Name)
+
+	_, err = target.Import(parsed, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, exportJSON(t, target))
+	light, err = target.GetLight("3")
+	require.NoError(t, err)
+	assert.Equal(t, "Porch", light.Name)
+	assert.Equal(t, "00:17:88:01:00:bd:c7:b9-03", light.UniqueID)
+	assert.Equal(t, uint8(20), light.State.Bri)
+
+	// the imported identity is used on the next start
+	target.bridges = []*ssdp.BridgeInfo{{SerialNumber: "001788FFFE000000"}}
+	require.NoError(t, target.SetupBolt())
+	assert.Equal(t, "001788FFFE23BFC1", target.bridges[0].SerialNumber)
+	recorder := request(target, "GET", "/bridge/001788FFFE23BFC1/device.xml", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "/bridge/001788FFFE23BFC1/")
+
+	// importing the same configuration again changes nothing
+	result, err = target.Import(parsed, true)
+	require.NoError(t, err)
+	for section, d := range result {
+		assert.Empty(t, d.Added, section)
+		assert.Empty(t, d.Removed, section)
+	}
+	assert.Empty(t, result["lights"].Changed)
+	assert.Empty(t, result["groups"].Changed)
+
+	parsed.Version = ExportVersion + 1
+	_, err = target.Import(parsed, false)
+	assert.ErrorIs(t, err, ErrInvalidExport)
+}
+
+func TestExportValidate(t *testing.T) {
+	valid := func() *Export {
+		return &Export{
+			Version: ExportVersion,
+			Bridge:  BridgeExport{Settings: DefaultBridgeSettings()},
+			Lights:  map[string]*LightInfo{"1": {Name: "Lamp", Type: TypeDimmable}},
+			Groups:  map[string]*GroupInfo{"1": {Name: "Room", Type: "Room", Lights: []string{"1"}}},
+		}
+	}
+	assert.NoError(t, valid().Validate())
+	groupScene := valid()
+	groupScene.Scenes = map[string]*SceneInfo{"a": {Type: "GroupScene", Group: allLightsGroup, Lights: []string{"1"}}}
+	assert.NoError(t, groupScene.Validate())
+
+	tests := map[string]func(e *Export){
+		"version":        func(e *Export) { e.Version = ExportVersion + 1 },
+		"settings":       func(e *Export) { e.Bridge.Settings = nil },
+		"light name":     func(e *Export) { e.Lights["2"] = &LightInfo{Name: "Lamp", Type: TypeDimmable} },
+		"light type":     func(e *Export) { e.Lights["1"].Type = "Toaster" },
+		"group light":    func(e *Export) { e.Groups["1"].Lights = []string{"7"} },
+		"group 0":        func(e *Export) { e.Groups["0"] = &GroupInfo{Type: "LightGroup"} },
+		"scene light":    func(e *Export) { e.Scenes = map[string]*SceneInfo{"a": {Lights: []string{"7"}}} },
+		"scene group":    func(e *Export) { e.Scenes = map[string]*SceneInfo{"a": {Group: "7"}} },
+		"scene state":    func(e *Export) { e.Scenes = map[string]*SceneInfo{"a": {LightStates: map[string]LightState{"7": {}}}} },
+		"action light":   func(e *Export) { e.Actions = map[string]*Action{"7": {URL: "http://localhost"}} },
+		"action invalid": func(e *Export) { e.Actions = map[string]*Action{"1": {URL: "ftp://localhost"}} },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := valid()
+			modify(e)
+			assert.Error(t, e.Validate())
+		})
+	}
+}
+
+func TestExportImportAllLightsScene(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall")
+	recorder := request(h, "POST", "/api/"+user+"/scenes", `{"name":"Everything","type":"GroupScene","group":"0"}`)
+	require.Contains(t, recorder.Body.String(), "success")
+
+	export, err := h.Export()
+	require.NoError(t, err)
+	result, err := h.Import(export, true)
+	require.NoError(t, err)
+	assert.Empty(t, result["scenes"].Added)
+	assert.Empty(t, result["scenes"].Changed)
+
+	expected := exportJSON(t, h)
+	_, err = h.Import(export, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, expected, exportJSON(t, h))
+}
+
+func TestAdminExportImport(t *testing.T) {
+	h := setupTestApi(t)
+	createLights(t, h, "Lamp")
+
+	recorder := adminRequest(h, "GET", "/admin/export?format=yaml", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "application/yaml")
+	document := recorder.Body.String()
+	assert.Contains(t, document, "name: Lamp")
+
+	recorder = adminRequest(h, "GET", "/admin/export", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"version":1`)
+
+	require.NoError(t, h.RenameLight("1", "Desk"))
+	recorder = adminRequest(h, "POST", "/admin/import?dryrun=true", document)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"lights":{"changed":["1"]}`)
+	light, err := h.GetLight("1")
+	require.NoError(t, err)
+	assert.Equal(t, "Desk", light.Name)
+
+	recorder = adminRequest(h, "POST", "/admin/import", document)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	light, err = h.GetLight("1")
+	require.NoError(t, err)
+	assert.Equal(t, "Lamp", light.Name)
+
+	recorder = adminRequest(h, "POST", "/admin/import", `{"version":1,"bridge":{}}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = adminRequest(h, "POST", "/admin/import", `version: [`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	recorder = request(h, "GET", "/admin/export", "")
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
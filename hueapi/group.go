@@ -0,0 +1,223 @@
+package hueapi
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// https://developers.meethue.com/develop/hue-api/groupds-api/
+
+const allLightsGroup = "0"
+
+var groupTypes = []string{"LightGroup", "Room", "Zone"}
+
+type GroupState struct {
+	AllOn bool `json:"all_on"`
+	AnyOn bool `json:"any_on"`
+}
+
+type GroupInfo struct {
+	Name    string     `json:"name"`
+	Lights  []string   `json:"lights"`
+	Type    string     `json:"type"`
+	Class   string     `json:"class,omitempty"`
+	State   GroupState `json:"state"`
+	Recycle bool       `json:"recycle"`
+	Action  LightState `json:"action"`
+}
+
+// GroupChange holds the group attributes of a create or update request.
+type GroupChange struct {
+	Name   *string  `json:"name,omitempty"`
+	Lights []string `json:"lights,omitempty"`
+	Type   *string  `json:"type,omitempty"`
+	Class  *string  `json:"class,omitempty"`
+}
+
+// updateState derives the group state from the state of its member lights.
+func (g *GroupInfo) updateState(lights map[string]*LightInfo) {
+	g.State = GroupState{AllOn: len(g.Lights) > 0}
+	for _, id := range g.Lights {
+		if light, ok := lights[id]; ok && light.State.On {
+			g.State.AnyOn = true
+		} else {
+			g.State.AllOn = false
+		}
+	}
+}
+
+// newAllLightsGroup returns the special group 0 which always contains all lights.
+func newAllLightsGroup(lights map[string]*LightInfo) *GroupInfo {
+	group := &GroupInfo{Name: "Group 0", Type: "LightGroup", Lights: sortedIds(lights)}
+	if len(group.Lights) > 0 {
+		group.Action = lights[group.Lights[0]].State
+	}
+	group.updateState(lights)
+	return group
+}
+
+// apply sets the attributes in change on the group, validating them against the known lights.
+func (g *GroupInfo) apply(id string, change *GroupChange, lights map[string]*LightInfo) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	basePath := fmt.Sprintf("/groups/%s", id)
+	if change.Type != nil {
+		if !slices.Contains(groupTypes, *change.Type) {
+			return nil, NewError(ErrorInvalidValue, basePath+"/type", *change.Type, "type")
+		}
+		g.Type = *change.Type
+	}
+	if change.Name != nil {
+		if *change.Name == "" || len(*change.Name) > 32 {
+			return nil, NewError(ErrorInvalidValue, basePath+"/name", *change.Name, "name")
+		}
+		g.Name = *change.Name
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/name": g.Name},
+		})
+	}
+	if change.Lights != nil {
+		g.Lights = make([]string, 0, len(change.Lights))
+		for _, lightId := range change.Lights {
+			if _, ok := lights[lightId]; !ok {
+				return nil, NewError(ErrorInvalidValue, basePath+"/lights", lightId, "lights")
+			}
+			if !slices.Contains(g.Lights, lightId) {
+				g.Lights = append(g.Lights, lightId)
+			}
+		}
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/lights": g.Lights},
+		})
+	}
+	if change.Class != nil {
+		g.Class = *change.Class
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/class": g.Class},
+		})
+	}
+	if g.Type == "" {
+		g.Type = "LightGroup"
+	}
+	if g.Type != "LightGroup" && g.Class == "" {
+		g.Class = "Other"
+	}
+	if g.Type == "LightGroup" {
+		g.Class = ""
+	}
+	return response, nil
+}
+
+// sortedIds returns the keys of a map of numeric ids in numeric order.
+func sortedIds[T any](m map[string]T) []string {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, errA := strconv.Atoi(ids[i])
+		b, errB := strconv.Atoi(ids[j])
+		if errA != nil || errB != nil {
+			return ids[i] < ids[j]
+		}
+		return a < b
+	})
+	return ids
+}
+
+// ChangeGroupState applies the change to every light of the group and runs the light callbacks.
+func (h *HueApi) ChangeGroupState(id string, change *StateChange) ([]map[string]interface{}, error) {
+	response, events, err := h.ApplyGroupStateChange(id, change)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		h.lightChanged(e)
+	}
+	return response, nil
+}
+
+func (h *HueApi) Groups(c *gin.Context) {
+	groups, err := h.GetGroups()
+	if err != nil {
+		abortWithError(c, "/groups", err)
+		return
+	}
+	c.JSON(http.StatusOK, groups)
+}
+
+func (h *HueApi) Group(c *gin.Context) {
+	groupId := c.Param("groupId")
+	group, err := h.GetGroup(groupId)
+	if err != nil {
+		abortWithError(c, "/groups/"+groupId, err)
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+func (h *HueApi) ApiCreateGroup(c *gin.Context) {
+	change := &GroupChange{}
+	if err := c.ShouldBindJSON(change); err != nil {
+		abortWithErrors(c, bindError("/groups", err))
+		return
+	}
+	if change.Lights == nil && (change.Type == nil || *change.Type == "LightGroup") {
+		abortWithErrors(c, NewError(ErrorMissingParameters, "/groups"))
+		return
+	}
+	groupId, err := h.CreateGroup(change)
+	if err != nil {
+		abortWithError(c, "/groups", err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": gin.H{"id": groupId}}})
+}
+
+func (h *HueApi) ApiUpdateGroup(c *gin.Context) {
+	groupId := c.Param("groupId")
+	change := &GroupChange{}
+	if err := c.ShouldBindJSON(change); err != nil {
+		abortWithErrors(c, bindError("/groups/"+groupId, err))
+		return
+	}
+	if change.Type != nil {
+		abortWithErrors(c, NewError(ErrorParameterNotModifiable, "/groups/"+groupId+"/type", "type"))
+		return
+	}
+	response, err := h.UpdateGroup(groupId, change)
+	if err != nil {
+		abortWithError(c, "/groups/"+groupId, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *HueApi) ApiDeleteGroup(c *gin.Context) {
+	groupId := c.Param("groupId")
+	if err := h.DeleteGroup(groupId); err != nil {
+		abortWithError(c, "/groups/"+groupId, err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": fmt.Sprintf("/groups/%s deleted", groupId)}})
+}
+
+func (h *HueApi) GroupAction(c *gin.Context) {
+	groupId := c.Param("groupId")
+	stateChange := &StateChange{}
+	if err := c.ShouldBindJSON(stateChange); err != nil {
+		abortWithErrors(c, bindError("/groups/"+groupId+"/action", err))
+		return
+	}
+	h.LogJson("groupAction", stateChange)
+
+	response, err := h.ChangeGroupState(groupId, stateChange)
+	if err != nil {
+		abortWithError(c, "/groups/"+groupId, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
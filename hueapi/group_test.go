@@ -0,0 +1,89 @@
+package hueapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createLights(t *testing.T, h *HueApi, names ...string) {
+	for _, name := range names {
+		_, _, err := h.PutLight(&LightInfo{Name: name})
+		assert.NoError(t, err)
+	}
+}
+
+func TestGroupLifecycle(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall", "Den")
+
+	recorder := request(h, "POST", "/api/"+user+"/groups", `{"name":"Downstairs","type":"Room","lights":["1","2","2"]}`)
+	assert.JSONEq(t, `[{"success":{"id":"1"}}]`, recorder.Body.String())
+
+	group, err := h.GetGroup("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Downstairs", group.Name)
+	assert.Equal(t, []string{"1", "2"}, group.Lights)
+	assert.Equal(t, "Other", group.Class)
+	assert.Equal(t, GroupState{AllOn: true, AnyOn: true}, group.State)
+
+	errs := hueErrors(t, request(h, "POST", "/api/"+user+"/groups", `{"lights":["9"]}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+	}
+
+	recorder = request(h, "PUT", "/api/"+user+"/groups/1", `{"name":"Ground floor","lights":["2","3"]}`)
+	assert.JSONEq(t, `[{"success":{"/groups/1/name":"Ground floor"}},{"success":{"/groups/1/lights":["2","3"]}}]`,
+		recorder.Body.String())
+
+	// deleting a light removes it from the group
+	assert.NoError(t, h.DeleteLight("3"))
+	group, err = h.GetGroup("1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, group.Lights)
+
+	errs = hueErrors(t, request(h, "DELETE", "/api/"+user+"/groups/0", ""))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorGroupNotModifiable, errs[0].Type)
+	}
+	recorder = request(h, "DELETE", "/api/"+user+"/groups/1", "")
+	assert.JSONEq(t, `[{"success":"/groups/1 deleted"}]`, recorder.Body.String())
+	assert.Equal(t, "{}", request(h, "GET", "/api/"+user+"/groups", "").Body.String())
+}
+
+func TestGroupAction(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall", "Den")
+
+	var events []string
+	h.AddLightCallback(func(e *LightEvent) { events = append(events, e.ID) })
+
+	_, err := h.CreateGroup(&GroupChange{Lights: []string{"1", "3"}})
+	assert.NoError(t, err)
+
+	recorder := request(h, "PUT", "/api/"+user+"/groups/1/action", `{"on":false,"bri":100}`)
+	assert.JSONEq(t, `[{"success":{"/groups/1/action/on":false}},{"success":{"/groups/1/action/bri":100}}]`,
+		recorder.Body.String())
+	assert.Equal(t, []string{"1", "3"}, events)
+
+	lights, err := h.GetLights()
+	assert.NoError(t, err)
+	assert.False(t, lights["1"].State.On)
+	assert.True(t, lights["2"].State.On)
+	assert.False(t, lights["3"].State.On)
+	assert.Equal(t, uint8(100), lights["3"].State.Bri)
+
+	group, err := h.GetGroup("1")
+	assert.NoError(t, err)
+	assert.False(t, group.Action.On)
+	assert.Equal(t, GroupState{}, group.State)
+
+	// group 0 contains all lights
+	request(h, "PUT", "/api/"+user+"/groups/0/action", `{"on":true}`)
+	group, err = h.GetGroup("0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, group.Lights)
+	assert.Equal(t, GroupState{AllOn: true, AnyOn: true}, group.State)
+}
@@ -10,43 +10,120 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 type HueApi struct {
-	engine  *gin.Engine
-	logger  servicego.Logger
-	addr    string
-	bridges []*ssdp.BridgeInfo
-	boltDb  *bbolt.DB
+	engine    *gin.Engine
+	logger    servicego.Logger
+	addr      string
+	bridges   []*ssdp.BridgeInfo
+	store     Store
+	callbacks []LightCallback
+
+	ssdpFilter  *ssdp.Filter
+	ssdpVerbose bool
+
+	mu              sync.Mutex
+	linkButtonUntil time.Time
+	transitions     map[string]*transition
+	colorloops      map[string]*colorloop
+	searchStart     time.Time
+	searchUntil     time.Time
+	newLights       map[string]string
+	alerts          map[string]*time.Timer
+	adminToken      string
+	actions         map[string]*Action
+	actionsVersion  int
+	actionWorkers   map[string]*actionWorker
+	// running tracks the transition, colorloop and action goroutines, none are started once shut down
+	running  sync.WaitGroup
+	shutdown bool
 }
 
+// New returns a HueApi storing its data in boltDb, or in a MemoryStore when boltDb is nil.
 func New(logger servicego.Logger, boltDb *bbolt.DB, addr string, bridges ...*ssdp.BridgeInfo) *HueApi {
+	var store Store = NewMemoryStore()
+	if boltDb != nil {
+		store = NewBoltStore(boltDb)
+	}
 	result := &HueApi{
-		logger:  logger,
-		boltDb:  boltDb,
-		addr:    addr,
-		bridges: bridges,
+		logger:     logger,
+		store:      store,
+		addr:       addr,
+		bridges:    bridges,
+		ssdpFilter: ssdp.DefaultFilter(),
 	}
+	result.AddLightCallback(result.ActionCallback)
 	result.setupEngine()
 	return result
 }
 
+// SetStore replaces the storage passed to New, it must be called before SetupBolt.
+func (h *HueApi) SetStore(store Store) {
+	h.store = store
+}
+
+// deviceLocation returns the url of the device description of the bridge with serial.
+func (h *HueApi) deviceLocation(serial string) string {
+	return fmt.Sprintf("http://%s/bridge/%s/device.xml", h.addr, serial)
+}
+
 func (h *HueApi) setupEngine() {
 	//gin.SetMode(gin.ReleaseMode)
 	h.engine = gin.New()
 	engine := h.engine
+	engine.HandleMethodNotAllowed = true
+	engine.NoRoute(h.NoRoute)
+	engine.NoMethod(h.NoMethod)
 	engine.Use(h.loggingHandler())
 	engine.Use(gin.Recovery())
 	for _, bridge := range h.bridges {
-		bridge.Location = fmt.Sprintf("http://%s/bridge/%s/device.xml", h.addr, bridge.SerialNumber)
+		bridge.Location = h.deviceLocation(bridge.SerialNumber)
 	}
 	engine.GET("/bridge/:serial/device.xml", h.DeviceHandler)
 	engine.POST("/api", h.Authenticate)
-	engine.GET("/api/:user/lights", h.Lights)
-	engine.PUT("/api/:user/lights", h.ApiPutLight)
-	engine.GET("/api/:user/lights/:lightId", h.Light)
-	engine.DELETE("/api/:user/lights/:lightId", h.Delete)
-	engine.PUT("/api/:user/lights/:lightId/state", h.LightState)
+	engine.GET("/api/config", h.ShortConfigHandler)
+	engine.GET("/api/:user/config", h.Config)
+
+	api := engine.Group("/api/:user", h.authorized)
+	api.GET("", h.FullState)
+	api.GET("/lights", h.Lights)
+	api.PUT("/lights", h.ApiPutLight)
+	api.POST("/lights", h.ApiSearchLights)
+	api.GET("/lights/new", h.ApiNewLights)
+	api.GET("/lights/:lightId", h.Light)
+	api.PUT("/lights/:lightId", h.ApiUpdateLight)
+	api.DELETE("/lights/:lightId", h.Delete)
+	api.PUT("/lights/:lightId/state", h.LightState)
+	api.GET("/groups", h.Groups)
+	api.POST("/groups", h.ApiCreateGroup)
+	api.GET("/groups/:groupId", h.Group)
+	api.PUT("/groups/:groupId", h.ApiUpdateGroup)
+	api.DELETE("/groups/:groupId", h.ApiDeleteGroup)
+	api.PUT("/groups/:groupId/action", h.GroupAction)
+	api.GET("/scenes", h.Scenes)
+	api.POST("/scenes", h.ApiCreateScene)
+	api.GET("/scenes/:sceneId", h.Scene)
+	api.PUT("/scenes/:sceneId", h.ApiUpdateScene)
+	api.DELETE("/scenes/:sceneId", h.ApiDeleteScene)
+	api.PUT("/scenes/:sceneId/lightstates/:lightId", h.ApiSceneLightState)
+	api.PUT("/config", h.ApiUpdateConfig)
+	api.DELETE("/config/whitelist/:username", h.ApiDeleteWhitelist)
+
+	admin := engine.Group("/admin", h.adminOnly)
+	admin.POST("/linkbutton", h.AdminLinkButton)
+	admin.GET("/staged", h.AdminStaged)
+	admin.PUT("/staged", h.AdminStageLight)
+	admin.DELETE("/staged/:name", h.AdminDeleteStaged)
+	admin.GET("/users", h.AdminUsers)
+	admin.DELETE("/users/:username", h.AdminDeleteUser)
+	admin.GET("/lights/:lightId/action", h.AdminGetAction)
+	admin.PUT("/lights/:lightId/action", h.AdminPutAction)
+	admin.DELETE("/lights/:lightId/action", h.AdminDeleteAction)
+	admin.GET("/export", h.AdminExport)
+	admin.POST("/import", h.AdminImport)
 }
 
 func (h *HueApi) DeviceHandler(c *gin.Context) {
@@ -54,7 +131,11 @@ func (h *HueApi) DeviceHandler(c *gin.Context) {
 
 	for _, bridge := range h.bridges {
 		if bridge.SerialNumber == serial {
-			urlBase := strings.Replace(bridge.Location, "device.xml", "", 1)
+			// the host the client reached the bridge on, ADDRESS may not name one
+			urlBase := fmt.Sprintf("http://%s/bridge/%s/", c.Request.Host, bridge.SerialNumber)
+			if c.Request.Host == "" {
+				urlBase = strings.Replace(bridge.Location, "device.xml", "", 1)
+			}
 			friendlyName := fmt.Sprintf("eHueGo v0.0.1 (%s)", bridge.SerialNumber)
 			description := NewDevice(urlBase, friendlyName, bridge.SerialNumber, bridge.UUID)
 			c.XML(200, description)
@@ -91,54 +172,69 @@ type AuthResponse struct {
 	} `json:"success"`
 }
 
-func (h *HueApi) Authenticate(c *gin.Context) {
-	authRequest := &AuthRequest{}
-	if err := c.ShouldBindJSON(authRequest); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	response := make([]AuthResponse, 1)
-	response[0].Success.Username = "83b7780291a6ceffbe0bd049104df"
-	c.JSON(http.StatusOK, response)
-}
-
 func (h *HueApi) Lights(c *gin.Context) {
 	getLights, err := h.GetLights()
 	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortWithError(c, "/lights", err)
 		return
 	}
-	c.JSON(http.StatusOK, getLights)
+	for id, light := range getLights {
+		light.State = h.currentState(id, light.State)
+	}
+	c.JSON(http.StatusOK, lightViews(getLights))
 }
 
 func (h *HueApi) Light(c *gin.Context) {
-	light, err := h.GetLight(c.Param("lightId"))
+	lightId := c.Param("lightId")
+	light, err := h.GetLight(lightId)
 	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
+		abortWithError(c, "/lights/"+lightId, err)
 		return
 	}
+	light.State = h.currentState(lightId, light.State)
 	h.LogJson("light", light)
-	c.JSON(http.StatusOK, light)
+	c.JSON(http.StatusOK, (*lightView)(light))
 }
 
-func (h *HueApi) LightState(c *gin.Context) {
-	id := c.Param("lightId")
-	light, err := h.GetLight(id)
-	if err != nil {
-		c.AbortWithStatus(http.StatusNotFound)
+func (h *HueApi) ApiUpdateLight(c *gin.Context) {
+	lightId := c.Param("lightId")
+	address := "/lights/" + lightId
+	change := &LightChange{}
+	if err := c.ShouldBindJSON(change); err != nil {
+		abortWithErrors(c, bindError(address, err))
+		return
+	}
+	if change.Name == nil {
+		abortWithErrors(c, NewError(ErrorMissingParameters, address))
 		return
 	}
+	if len(*change.Name) == 0 || len(*change.Name) > 32 {
+		abortWithErrors(c, NewError(ErrorInvalidValue, address+"/name", *change.Name, "name"))
+		return
+	}
+	if err := h.RenameLight(lightId, *change.Name); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			abortWithErrors(c, NewError(ErrorInvalidValue, address+"/name", *change.Name, "name"))
+			return
+		}
+		abortWithError(c, address, err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": gin.H{address + "/name": *change.Name}}})
+}
+
+func (h *HueApi) LightState(c *gin.Context) {
+	id := c.Param("lightId")
 	stateChange := &StateChange{}
-	if err = c.ShouldBindJSON(stateChange); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(stateChange); err != nil {
+		abortWithErrors(c, bindError("/lights/"+id+"/state", err))
 		return
 	}
 	h.LogJson("stateChange", stateChange)
 
-	response := light.ApplyStateChange(id, stateChange)
-	err = h.UpdateLight(id, light)
+	response, err := h.ChangeLightState(id, stateChange)
 	if err != nil {
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortWithError(c, "/lights/"+id, err)
 		return
 	}
 
@@ -147,6 +243,30 @@ func (h *HueApi) LightState(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// ChangeLightState applies the change to the stored light, persists it and runs the light callbacks.
+// Attributes the type of the light does not support are answered with error entries.
+func (h *HueApi) ChangeLightState(id string, change *StateChange) ([]map[string]interface{}, error) {
+	basePath := fmt.Sprintf("/lights/%s/state", id)
+	if err := change.Validate(basePath); err != nil {
+		return nil, err
+	}
+	var response []map[string]interface{}
+	var previous LightState
+	light, err := h.ModifyLight(id, func(light *LightInfo) error {
+		profile := profileFor(light.Type)
+		previous = light.State
+		response = profile.unsupported(basePath, change)
+		change = profile.filter(change)
+		response = append(response, light.ApplyStateChange(id, change)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.lightChanged(&LightEvent{ID: id, Light: light, State: light.State, Previous: previous, Change: change})
+	return response, nil
+}
+
 func (h *HueApi) LogJson(name string, what any) {
 	marshal, err := json.Marshal(what)
 	if err != nil {
@@ -159,32 +279,38 @@ func (h *HueApi) Delete(c *gin.Context) {
 	lightId := c.Param("lightId")
 	err := h.DeleteLight(lightId)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			c.AbortWithStatus(http.StatusNotFound)
-			return
-		}
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortWithError(c, "/lights/"+lightId, err)
 		return
 	}
-	c.Status(http.StatusOK)
+	h.cancelTransition(lightId)
+	h.cancelEffects(lightId)
+	c.JSON(http.StatusOK, []gin.H{{"success": fmt.Sprintf("/lights/%s deleted", lightId)}})
 }
 
 func (h *HueApi) ApiPutLight(c *gin.Context) {
 	light := &LightInfo{}
 	if err := c.ShouldBindJSON(light); err != nil {
-		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		abortWithErrors(c, bindError("/lights", err))
+		return
+	}
+	if light.Name == "" {
+		abortWithErrors(c, NewError(ErrorMissingParameters, "/lights"))
+		return
+	}
+	if _, ok := ProfileFor(light.Type); light.Type != "" && !ok {
+		abortWithErrors(c, NewError(ErrorInvalidValue, "/lights/type", light.Type, "type"))
 		return
 	}
 
 	dbLight, lightId, err := h.PutLight(light)
 	if err != nil {
 		if strings.Contains(err.Error(), "already exists") {
-			c.AbortWithStatus(http.StatusConflict)
+			abortWithErrors(c, NewError(ErrorInvalidValue, "/lights/name", light.Name, "name"))
 			return
 		}
-		c.AbortWithStatus(http.StatusInternalServerError)
+		abortWithError(c, "/lights", err)
 		return
 	}
-	response := map[string]interface{}{lightId: dbLight}
+	response := map[string]interface{}{lightId: (*lightView)(dbLight)}
 	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,160 @@
+package hueapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/goccy/go-json"
+	"github.com/mlctrez/ehugo/ssdp"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestApi(t *testing.T) *HueApi {
+	gin.SetMode(gin.TestMode)
+	h := setupTestDB(t)
+	h.logger = &testLogger{t}
+	h.setupEngine()
+	return h
+}
+
+func testUser(t *testing.T, h *HueApi) string {
+	username, err := h.AddUser("test#device")
+	assert.NoError(t, err)
+	return username
+}
+
+func request(h *HueApi, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	h.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func adminRequest(h *HueApi, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "127.0.0.1:52000"
+	h.Handler().ServeHTTP(recorder, req)
+	return recorder
+}
+
+func hueErrors(t *testing.T, recorder *httptest.ResponseRecorder) []*HueError {
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response []ErrorResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	var result []*HueError
+	for _, r := range response {
+		result = append(result, r.Error)
+	}
+	return result
+}
+
+func TestHueErrors(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+
+	tests := []struct {
+		name, method, path, body string
+		expected                 *HueError
+	}{
+		{"light not found", "GET", "/api/" + user + "/lights/7", "",
+			&HueError{ErrorResourceNotAvailable, "/lights/7", "resource, /lights/7, not available"}},
+		{"delete not found", "DELETE", "/api/" + user + "/lights/7", "",
+			&HueError{ErrorResourceNotAvailable, "/lights/7", "resource, /lights/7, not available"}},
+		{"state not found", "PUT", "/api/" + user + "/lights/7/state", `{"on":true}`,
+			&HueError{ErrorResourceNotAvailable, "/lights/7", "resource, /lights/7, not available"}},
+		{"invalid json", "PUT", "/api/" + user + "/lights/7/state", `{"on":`,
+			&HueError{ErrorInvalidJSON, "/lights/7/state", "body contains invalid json"}},
+		{"invalid value", "PUT", "/api/" + user + "/lights/7/state", `{"bri":300}`,
+			&HueError{ErrorInvalidValue, "/lights/7/state/bri", "invalid value, 300, for parameter, bri"}},
+		{"missing devicetype", "POST", "/api", `{}`,
+			&HueError{ErrorMissingParameters, "/", "missing parameters in body"}},
+		{"unknown resource", "GET", "/api/" + user + "/unknown", "",
+			&HueError{ErrorResourceNotAvailable, "/unknown", "resource, /unknown, not available"}},
+		{"unauthorized user", "GET", "/api/nobody/lights", "",
+			&HueError{ErrorUnauthorizedUser, "/lights", "unauthorized user"}},
+		{"method not available", "POST", "/api/" + user + "/lights/1/state", "",
+			&HueError{ErrorMethodNotAvailable, "/lights/1/state", "method, POST, not available for resource, /lights/1/state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := hueErrors(t, request(h, tt.method, tt.path, tt.body))
+			if assert.Len(t, errs, 1) {
+				assert.Equal(t, tt.expected, errs[0])
+			}
+		})
+	}
+}
+
+func TestApiPutLightDuplicateName(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights", `{"name":"Lamp"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"1":`)
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/lights", `{"name":"Lamp"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+		assert.Equal(t, "/lights/name", errs[0].Address)
+	}
+
+	recorder = request(h, "DELETE", "/api/"+user+"/lights/1", "")
+	assert.JSONEq(t, `[{"success":"/lights/1 deleted"}]`, recorder.Body.String())
+}
+
+func TestApiUpdateLight(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp", "Desk")
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights/1", `{"name":"Reading lamp"}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/name":"Reading lamp"}}]`, recorder.Body.String())
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Reading lamp", light.Name)
+
+	// keeping the own name is not a duplicate
+	recorder = request(h, "PUT", "/api/"+user+"/lights/1", `{"name":"Reading lamp"}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/name":"Reading lamp"}}]`, recorder.Body.String())
+
+	for body, errorType := range map[string]ErrorType{
+		`{"name":"Desk"}`: ErrorInvalidValue,
+		`{"name":""}`:     ErrorInvalidValue,
+		`{}`:              ErrorMissingParameters,
+		`{"name":5}`:      ErrorInvalidValue,
+	} {
+		errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/lights/1", body))
+		if assert.Len(t, errs, 1, body) {
+			assert.Equal(t, errorType, errs[0].Type, body)
+		}
+	}
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/lights/9", `{"name":"Nowhere"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorResourceNotAvailable, errs[0].Type)
+	}
+}
+
+func TestDeviceHandler(t *testing.T) {
+	h := setupTestDB(t)
+	h.addr = ":80"
+	h.bridges = []*ssdp.BridgeInfo{{SerialNumber: "001788FFFE23BFC1", UUID: "2f402f80-da50-11e1-9b23-001788255acc"}}
+	h.setupEngine()
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/bridge/001788FFFE23BFC1/device.xml", nil)
+	req.Host = "192.168.1.5:80"
+	h.Handler().ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "<URLBase>http://192.168.1.5:80/bridge/001788FFFE23BFC1/</URLBase>")
+
+	recorder = request(h, "GET", "/bridge/001788FFFE000000/device.xml", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
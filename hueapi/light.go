@@ -1,6 +1,11 @@
 package hueapi
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/mlctrez/ehugo/color"
+	"math"
+	"slices"
+)
 
 // https://developers.meethue.com/develop/hue-api/lights-api/
 
@@ -28,12 +33,18 @@ type LightInfo struct {
 	SWVersion        string     `json:"swversion"`
 }
 
+// LightChange holds the modifiable attributes of a light.
+type LightChange struct {
+	Name *string `json:"name,omitempty"`
+}
+
 func (l *LightInfo) Defaults(id string) {
 	if l.Type == "" {
-		l.Type = "Extended color light"
+		l.Type = TypeExtendedColor
 	}
+	profile := profileFor(l.Type)
 	if l.ModelID == "" {
-		l.ModelID = "LCT007"
+		l.ModelID = profile.ModelID
 	}
 	if l.ManufacturerName == "" {
 		l.ManufacturerName = "Philips"
@@ -50,15 +61,15 @@ func (l *LightInfo) Defaults(id string) {
 		Bri:       254,
 		Hue:       0,
 		Sat:       0,
-		Effect:    "none",
-		XY:        []float64{0.0, 0.0},
-		Ct:        366,
-		Alert:     "none",
-		ColorMode: "ct",
+		Effect:    EffectNone,
+		XY:        []float64{0.3227, 0.329},
+		Ct:        max(profile.CtMin, min(profile.CtMax, 366)),
+		Alert:     AlertNone,
+		ColorMode: profile.colorMode(),
 		Mode:      "homeautomation",
 		Reachable: true,
 	}
-
+	l.syncColor()
 }
 
 type StateChange struct {
@@ -70,12 +81,111 @@ type StateChange struct {
 	XY     []float64 `json:"xy,omitempty"`
 	Ct     *uint16   `json:"ct,omitempty"`
 	Alert  *string   `json:"alert,omitempty"`
+	Scene  *string   `json:"scene,omitempty"`
+
+	TransitionTime *uint16 `json:"transitiontime,omitempty"`
+
+	// relative changes, ignored when the absolute value is also given
+	BriInc *int16    `json:"bri_inc,omitempty"`
+	SatInc *int16    `json:"sat_inc,omitempty"`
+	HueInc *int32    `json:"hue_inc,omitempty"`
+	CtInc  *int32    `json:"ct_inc,omitempty"`
+	XYInc  []float64 `json:"xy_inc,omitempty"`
+}
+
+// Validate checks the values of the attributes and the ranges of the relative changes.
+func (c *StateChange) Validate(basePath string) error {
+	invalid := func(attribute string, value any) error {
+		return NewError(ErrorInvalidValue, basePath+"/"+attribute, fmt.Sprint(value), attribute)
+	}
+	if c.Ct != nil && (*c.Ct < 153 || *c.Ct > 500) {
+		return invalid("ct", *c.Ct)
+	}
+	if c.XY != nil && (len(c.XY) != 2 || c.XY[0] < 0 || c.XY[0] > 1 || c.XY[1] < 0 || c.XY[1] > 1) {
+		return invalid("xy", c.XY)
+	}
+	if c.Effect != nil && *c.Effect != EffectNone && *c.Effect != EffectColorLoop {
+		return invalid("effect", *c.Effect)
+	}
+	if c.Alert != nil && *c.Alert != AlertNone && *c.Alert != AlertSelect && *c.Alert != AlertLSelect {
+		return invalid("alert", *c.Alert)
+	}
+	if c.BriInc != nil && (*c.BriInc < -254 || *c.BriInc > 254) {
+		return invalid("bri_inc", *c.BriInc)
+	}
+	if c.SatInc != nil && (*c.SatInc < -254 || *c.SatInc > 254) {
+		return invalid("sat_inc", *c.SatInc)
+	}
+	if c.HueInc != nil && (*c.HueInc < -65534 || *c.HueInc > 65534) {
+		return invalid("hue_inc", *c.HueInc)
+	}
+	if c.CtInc != nil && (*c.CtInc < -65534 || *c.CtInc > 65534) {
+		return invalid("ct_inc", *c.CtInc)
+	}
+	if c.XYInc != nil {
+		if len(c.XYInc) != 2 || c.XYInc[0] < -0.5 || c.XYInc[0] > 0.5 || c.XYInc[1] < -0.5 || c.XYInc[1] > 0.5 {
+			return invalid("xy_inc", c.XYInc)
+		}
+	}
+	return nil
+}
+
+// roundXY rounds xy coordinates to the precision reported by the bridge.
+func roundXY(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+// syncColor derives the other color representations from the one selected by the colormode,
+// keeping xy inside the gamut of the model.
+func (l *LightInfo) syncColor() {
+	gamut := color.GamutForModel(l.ModelID)
+	var xy color.Point
+	switch l.State.ColorMode {
+	case "hs":
+		xy = gamut.Clamp(color.HueSatToXY(l.State.Hue, l.State.Sat))
+	case "xy":
+		if len(l.State.XY) != 2 {
+			return
+		}
+		xy = gamut.Clamp(color.Point{X: l.State.XY[0], Y: l.State.XY[1]})
+		l.State.Hue, l.State.Sat = color.XYToHueSat(xy)
+	case "ct":
+		xy = gamut.Clamp(color.MirekToXY(l.State.Ct))
+		l.State.Hue, l.State.Sat = color.XYToHueSat(xy)
+	default:
+		return
+	}
+	l.State.XY = []float64{roundXY(xy.X), roundXY(xy.Y)}
+	if l.State.ColorMode != "ct" {
+		ctMin, ctMax := l.ctRange()
+		l.State.Ct = max(ctMin, min(ctMax, color.XYToMirek(xy)))
+	}
+}
+
+// RGB returns the color of the state at its brightness, for integrations that need RGB or hex values.
+func (s LightState) RGB() color.RGB {
+	if !s.On || len(s.XY) != 2 {
+		return color.RGB{}
+	}
+	return color.XYToRGB(color.Point{X: s.XY[0], Y: s.XY[1]}, s.Bri)
+}
+
+// ctRange returns the supported color temperature range in mirek.
+func (l *LightInfo) ctRange() (uint16, uint16) {
+	if profile := profileFor(l.Type); profile.CtMax > 0 {
+		return profile.CtMin, profile.CtMax
+	}
+	return 153, 500
 }
 
 func (l *LightInfo) ApplyStateChange(id string, change *StateChange) []map[string]interface{} {
-	var response []map[string]interface{}
+	return l.applyStateChange(fmt.Sprintf("/lights/%s/state", id), change)
+}
 
-	basePath := fmt.Sprintf("/lights/%s/state", id)
+// applyStateChange applies the change and returns success entries for paths below basePath.
+func (l *LightInfo) applyStateChange(basePath string, change *StateChange) []map[string]interface{} {
+	var response []map[string]interface{}
+	before := l.State
 
 	if change.On != nil {
 		l.State.On = *change.On
@@ -111,6 +221,129 @@ func (l *LightInfo) ApplyStateChange(id string, change *StateChange) []map[strin
 			"success": map[string]interface{}{basePath + "/ct": change.Ct},
 		})
 	}
+	if len(change.XY) == 2 {
+		l.State.XY = []float64{change.XY[0], change.XY[1]}
+		l.State.ColorMode = "xy"
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/xy": change.XY},
+		})
+	}
+	if change.Effect != nil {
+		l.State.Effect = *change.Effect
+		if l.State.Effect == EffectColorLoop {
+			l.State.ColorMode = "hs"
+		}
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/effect": change.Effect},
+		})
+	}
+	if change.Alert != nil {
+		l.State.Alert = *change.Alert
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/alert": change.Alert},
+		})
+	}
+
+	if change.Bri == nil && change.BriInc != nil {
+		l.State.Bri = uint8(max(1, min(254, int(l.State.Bri)+int(*change.BriInc))))
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/bri": l.State.Bri},
+		})
+	}
+	if change.Hue == nil && change.HueInc != nil {
+		l.State.Hue = uint16(((int(l.State.Hue)+int(*change.HueInc))%65536 + 65536) % 65536)
+		l.State.ColorMode = "hs"
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/hue": l.State.Hue},
+		})
+	}
+	if change.Sat == nil && change.SatInc != nil {
+		l.State.Sat = uint8(max(0, min(254, int(l.State.Sat)+int(*change.SatInc))))
+		l.State.ColorMode = "hs"
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/sat": l.State.Sat},
+		})
+	}
+	if change.Ct == nil && change.CtInc != nil {
+		ctMin, ctMax := l.ctRange()
+		l.State.Ct = uint16(max(int(ctMin), min(int(ctMax), int(l.State.Ct)+int(*change.CtInc))))
+		l.State.ColorMode = "ct"
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/ct": l.State.Ct},
+		})
+	}
+	if change.XY == nil && len(change.XYInc) == 2 && len(l.State.XY) == 2 {
+		xy := color.GamutForModel(l.ModelID).Clamp(color.Point{
+			X: l.State.XY[0] + change.XYInc[0], Y: l.State.XY[1] + change.XYInc[1],
+		})
+		l.State.XY = []float64{roundXY(xy.X), roundXY(xy.Y)}
+		l.State.ColorMode = "xy"
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/xy": l.State.XY},
+		})
+	}
+
+	if l.State.ColorMode != before.ColorMode || l.State.Hue != before.Hue || l.State.Sat != before.Sat ||
+		l.State.Ct != before.Ct || !slices.Equal(l.State.XY, before.XY) {
+		l.syncColor()
+	}
+
+	if change.TransitionTime != nil && len(response) > 0 {
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/transitiontime": change.TransitionTime},
+		})
+	}
 
 	return response
 }
+
+// mergeStateChange returns base with the fields set in overlay replaced.
+func mergeStateChange(base, overlay *StateChange) *StateChange {
+	merged := *base
+	if overlay.On != nil {
+		merged.On = overlay.On
+	}
+	if overlay.Bri != nil {
+		merged.Bri = overlay.Bri
+	}
+	if overlay.Hue != nil {
+		merged.Hue = overlay.Hue
+	}
+	if overlay.Sat != nil {
+		merged.Sat = overlay.Sat
+	}
+	if overlay.Effect != nil {
+		merged.Effect = overlay.Effect
+	}
+	if overlay.XY != nil {
+		merged.XY = overlay.XY
+	}
+	if overlay.Ct != nil {
+		merged.Ct = overlay.Ct
+	}
+	if overlay.Alert != nil {
+		merged.Alert = overlay.Alert
+	}
+	if overlay.Scene != nil {
+		merged.Scene = overlay.Scene
+	}
+	if overlay.TransitionTime != nil {
+		merged.TransitionTime = overlay.TransitionTime
+	}
+	if overlay.BriInc != nil {
+		merged.BriInc = overlay.BriInc
+	}
+	if overlay.SatInc != nil {
+		merged.SatInc = overlay.SatInc
+	}
+	if overlay.HueInc != nil {
+		merged.HueInc = overlay.HueInc
+	}
+	if overlay.CtInc != nil {
+		merged.CtInc = overlay.CtInc
+	}
+	if overlay.XYInc != nil {
+		merged.XYInc = overlay.XYInc
+	}
+	return &merged
+}
@@ -0,0 +1,201 @@
+package hueapi
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLightStateIncrements(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"hue":5,"sat":3}`)
+
+	// bri clamps at the top, hue wraps around
+	recorder := request(h, "PUT", "/api/"+user+"/lights/1/state", `{"bri_inc":100,"hue_inc":-10}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/bri":254}},{"success":{"/lights/1/state/hue":65531}}]`,
+		recorder.Body.String())
+
+	recorder = request(h, "PUT", "/api/"+user+"/lights/1/state", `{"bri_inc":-254,"hue_inc":20,"sat_inc":-5}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/bri":1}},{"success":{"/lights/1/state/hue":15}},`+
+		`{"success":{"/lights/1/state/sat":0}}]`, recorder.Body.String())
+
+	// ct clamps to the range of the light
+	recorder = request(h, "PUT", "/api/"+user+"/lights/1/state", `{"ct_inc":1000}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/ct":500}}]`, recorder.Body.String())
+
+	// xy clamps into the gamut of the light
+	recorder = request(h, "PUT", "/api/"+user+"/lights/1/state", `{"xy":[0.6,0.35]}`)
+	recorder = request(h, "PUT", "/api/"+user+"/lights/1/state", `{"xy_inc":[0.2,-0.1]}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/xy":[0.675,0.322]}}]`, recorder.Body.String())
+
+	// the absolute value takes precedence
+	recorder = request(h, "PUT", "/api/"+user+"/lights/1/state", `{"bri":100,"bri_inc":10}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/bri":100}}]`, recorder.Body.String())
+
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(100), light.State.Bri)
+	assert.Equal(t, []float64{0.675, 0.322}, light.State.XY)
+	assert.Equal(t, "xy", light.State.ColorMode)
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/lights/1/state", `{"bri_inc":300}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+		assert.Equal(t, "/lights/1/state/bri_inc", errs[0].Address)
+	}
+}
+
+func TestGroupActionIncrements(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall")
+
+	bri := uint8(50)
+	_, err := h.ChangeLightState("2", &StateChange{Bri: &bri})
+	assert.NoError(t, err)
+
+	request(h, "PUT", "/api/"+user+"/groups/0/action", `{"bri_inc":-60}`)
+	lights, err := h.GetLights()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(194), lights["1"].State.Bri)
+	assert.Equal(t, uint8(1), lights["2"].State.Bri)
+}
+
+func TestLightStateColor(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights/1/state", `{"xy":[0.4,0.4]}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/xy":[0.4,0.4]}}]`, recorder.Body.String())
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.4, 0.4}, light.State.XY)
+	assert.Equal(t, "xy", light.State.ColorMode)
+	// the other representations follow the color
+	assert.Greater(t, light.State.Sat, uint8(0))
+	assert.Greater(t, light.State.Ct, uint16(153))
+
+	// colors outside the gamut of the model are clamped onto its edge
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"hue":21845,"sat":254}`)
+	light, err = h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{0.409, 0.518}, light.State.XY)
+	assert.Equal(t, uint16(21845), light.State.Hue)
+	assert.Equal(t, "#ebff43", light.State.RGB().Hex())
+
+	for _, body := range []string{`{"xy":[0.3]}`, `{"xy":[1.5,0]}`, `{"effect":"rainbow"}`, `{"alert":"blink"}`} {
+		errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/lights/1/state", body))
+		if assert.Len(t, errs, 1, body) {
+			assert.Equal(t, ErrorInvalidValue, errs[0].Type, body)
+		}
+	}
+}
+
+func TestLightStateColorloop(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	var mu sync.Mutex
+	var hues []uint16
+	h.AddLightCallback(func(e *LightEvent) {
+		if e.Effect {
+			assert.False(t, e.Transition)
+			mu.Lock()
+			hues = append(hues, e.State.Hue)
+			mu.Unlock()
+		}
+	})
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights/1/state", `{"effect":"colorloop"}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/effect":"colorloop"}}]`, recorder.Body.String())
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, EffectColorLoop, light.State.Effect)
+
+	assert.Eventually(t, func() bool {
+		return h.currentState("1", light.State).Hue != light.State.Hue
+	}, 2*time.Second, 50*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(hues) > 0
+	}, 2*time.Second, 50*time.Millisecond)
+
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"effect":"none"}`)
+	light, err = h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, EffectNone, light.State.Effect)
+	assert.Equal(t, light.State, h.currentState("1", light.State))
+}
+
+func TestLightStateAlert(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	var mu sync.Mutex
+	var alerts []string
+	h.AddLightCallback(func(e *LightEvent) {
+		mu.Lock()
+		alerts = append(alerts, e.State.Alert)
+		mu.Unlock()
+	})
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights/1/state", `{"alert":"select"}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/alert":"select"}}]`, recorder.Body.String())
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, AlertSelect, light.State.Alert)
+
+	assert.Eventually(t, func() bool {
+		light, err = h.GetLight("1")
+		return err == nil && light.State.Alert == AlertNone
+	}, 3*time.Second, 50*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{AlertSelect, AlertNone}, alerts)
+}
+
+func TestShutdownStopsEffects(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	var mu sync.Mutex
+	var events int
+	h.AddLightCallback(func(e *LightEvent) {
+		mu.Lock()
+		events++
+		mu.Unlock()
+	})
+
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"effect":"colorloop","alert":"lselect","bri":54,"transitiontime":50}`)
+	h.Shutdown()
+	h.mu.Lock()
+	assert.Empty(t, h.transitions)
+	assert.Empty(t, h.colorloops)
+	assert.Empty(t, h.alerts)
+	h.mu.Unlock()
+
+	mu.Lock()
+	stopped := events
+	mu.Unlock()
+	time.Sleep(600 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, stopped, events)
+	mu.Unlock()
+
+	// changes are still applied but no effects are started after the shutdown
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"effect":"colorloop","bri":100,"transitiontime":50}`)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Empty(t, h.transitions)
+	assert.Empty(t, h.colorloops)
+}
@@ -0,0 +1,161 @@
+package hueapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"strconv"
+	"time"
+)
+
+// migration upgrades the database schema by one version.
+type migration struct {
+	description string
+	migrate     func(tx *bbolt.Tx) error
+}
+
+// migrations are applied in order, migrations[i] upgrades the schema from version i to i+1.
+// Append new migrations at the end and never change released ones.
+var migrations = []migration{
+	{"create buckets", createBuckets},
+	{"fill in light attributes", fillLightAttributes},
+	{"record the last light id", recordLastLightId},
+}
+
+// SchemaVersion is the database schema version supported by this build, the number of migrations.
+const SchemaVersion = 3
+
+const metaBucket = "meta"
+const schemaKey = "schema"
+
+func createBuckets(tx *bbolt.Tx) error {
+	for _, name := range []string{"lights", "actions", "whitelist", "groups", "scenes", "config", "staged"} {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillLightAttributes completes lights stored before light types, effects and color conversion existed.
+func fillLightAttributes(tx *bbolt.Tx) error {
+	bucket := tx.Bucket([]byte("lights"))
+	lights := make(map[string]*LightInfo)
+	err := bucket.ForEach(func(k, v []byte) error {
+		light := &LightInfo{}
+		if err := json.Unmarshal(v, light); err != nil {
+			return fmt.Errorf("light %s: %w", k, err)
+		}
+		lights[string(k)] = light
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, light := range lights {
+		if light.Type == "" {
+			light.Type = TypeExtendedColor
+		}
+		profile := profileFor(light.Type)
+		if light.ModelID == "" {
+			light.ModelID = profile.ModelID
+		}
+		if light.State.Effect == "" {
+			light.State.Effect = EffectNone
+		}
+		if light.State.Alert == "" {
+			light.State.Alert = AlertNone
+		}
+		if light.State.ColorMode == "" {
+			light.State.ColorMode = profile.colorMode()
+		}
+		light.syncColor()
+		if err = writeLight(boltTx{tx}, id, light); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordLastLightId starts the light id counter at the highest existing id.
+func recordLastLightId(tx *bbolt.Tx) error {
+	lights, err := readLights(boltTx{tx})
+	if err != nil {
+		return err
+	}
+	bucket, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(lastLightIdKey), []byte(strconv.Itoa(lastLightId(0, lights))))
+}
+
+// schemaVersion returns the schema version stored in the meta bucket, 0 for databases without one.
+func schemaVersion(tx *bbolt.Tx) (int, error) {
+	bucket := tx.Bucket([]byte(metaBucket))
+	if bucket == nil {
+		return 0, nil
+	}
+	v := bucket.Get([]byte(schemaKey))
+	if v == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", v)
+	}
+	return version, nil
+}
+
+// migrate upgrades a bbolt database to SchemaVersion. A database which already has data is backed up
+// next to the database file before the first migration runs. Databases with a newer schema are refused.
+func (h *HueApi) migrate(db *bbolt.DB) error {
+	var version int
+	var empty bool
+	err := db.View(func(tx *bbolt.Tx) (err error) {
+		version, err = schemaVersion(tx)
+		empty = tx.ForEach(func([]byte, *bbolt.Bucket) error { return fmt.Errorf("not empty") }) == nil
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+	if version == SchemaVersion {
+		return nil
+	}
+	if !empty {
+		if err = h.backup(db, version); err != nil {
+			return err
+		}
+	}
+	for ; version < SchemaVersion; version++ {
+		m := migrations[version]
+		h.logger.Infof("migrating database schema to version %d: %s", version+1, m.description)
+		err = db.Update(func(tx *bbolt.Tx) error {
+			if err := m.migrate(tx); err != nil {
+				return err
+			}
+			bucket, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+			if err != nil {
+				return err
+			}
+			return bucket.Put([]byte(schemaKey), []byte(strconv.Itoa(version+1)))
+		})
+		if err != nil {
+			return fmt.Errorf("migration to schema version %d failed: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// backup copies the database file before migrating it from version.
+func (h *HueApi) backup(db *bbolt.DB, version int) error {
+	path := fmt.Sprintf("%s.v%d-%s.bak", db.Path(), version, time.Now().Format("20060102150405"))
+	h.logger.Infof("backing up database to %s", path)
+	return db.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
@@ -0,0 +1,137 @@
+package hueapi
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/bbolt"
+)
+
+// openTestDB returns a HueApi storing its data in a new bbolt database.
+func openTestDB(t *testing.T) (*HueApi, *bbolt.DB) {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return &HueApi{logger: &testLogger{t}, store: NewBoltStore(db)}, db
+}
+
+func backups(t *testing.T, db *bbolt.DB) []string {
+	matches, err := filepath.Glob(db.Path() + ".v*.bak")
+	require.NoError(t, err)
+	return matches
+}
+
+func TestMigrationsMatchSchemaVersion(t *testing.T) {
+	assert.Len(t, migrations, SchemaVersion)
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	h, db := openTestDB(t)
+	require.NoError(t, h.SetupBolt())
+
+	err := db.View(func(tx *bbolt.Tx) error {
+		version, err := schemaVersion(tx)
+		assert.Equal(t, SchemaVersion, version)
+		return err
+	})
+	assert.NoError(t, err)
+	// there is nothing to back up in a new database
+	assert.Empty(t, backups(t, db))
+
+	// running again is a no-op
+	require.NoError(t, h.SetupBolt())
+	assert.Empty(t, backups(t, db))
+}
+
+func TestMigrateUnversionedDatabase(t *testing.T) {
+	h, db := openTestDB(t)
+	// a database written before schema versioning with a light lacking newer attributes
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("lights"))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("1"), []byte(`{"name":"Lamp","state":{"on":true,"bri":254,"ct":366,"xy":[0,0]}}`))
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, h.SetupBolt())
+	assert.Len(t, backups(t, db), 1)
+
+	light, err := h.GetLight("1")
+	require.NoError(t, err)
+	assert.Equal(t, TypeExtendedColor, light.Type)
+	assert.Equal(t, "LCT007", light.ModelID)
+	assert.Equal(t, "ct", light.State.ColorMode)
+	assert.Equal(t, EffectNone, light.State.Effect)
+	assert.Equal(t, AlertNone, light.State.Alert)
+	assert.NotEqual(t, []float64{0, 0}, light.State.XY)
+
+	// buckets added later exist as well
+	_, err = h.GetGroups()
+	assert.NoError(t, err)
+}
+
+func TestMigrateLastLightId(t *testing.T) {
+	h, db := openTestDB(t)
+	err := db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("lights"))
+		if err != nil {
+			return err
+		}
+		for _, id := range []string{"1", "4"} {
+			if err = bucket.Put([]byte(id), []byte(`{"name":"Lamp `+id+`","state":{}}`)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, h.SetupBolt())
+
+	_, id, err := h.PutLight(&LightInfo{Name: "Desk"})
+	require.NoError(t, err)
+	assert.Equal(t, "5", id)
+}
+
+func TestMigrateNewerSchema(t *testing.T) {
+	h, db := openTestDB(t)
+	require.NoError(t, h.SetupBolt())
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(metaBucket)).Put([]byte(schemaKey), []byte("99"))
+	})
+	require.NoError(t, err)
+
+	assert.ErrorContains(t, h.SetupBolt(), "newer than supported")
+	assert.Empty(t, backups(t, db))
+}
+
+func TestMigrateBackup(t *testing.T) {
+	h, db := openTestDB(t)
+	require.NoError(t, h.SetupBolt())
+	_, _, err := h.PutLight(&LightInfo{Name: "Lamp"})
+	require.NoError(t, err)
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(metaBucket)).Put([]byte(schemaKey), []byte("1"))
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, h.SetupBolt())
+	files := backups(t, db)
+	require.Len(t, files, 1)
+	assert.Contains(t, files[0], ".v1-")
+
+	// the backup is a usable database at the previous version
+	backup, err := bbolt.Open(files[0], 0600, &bbolt.Options{ReadOnly: true})
+	require.NoError(t, err)
+	defer backup.Close()
+	err = backup.View(func(tx *bbolt.Tx) error {
+		version, err := schemaVersion(tx)
+		assert.Equal(t, 1, version)
+		assert.NotNil(t, tx.Bucket([]byte("lights")).Get([]byte("1")))
+		return err
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,261 @@
+package hueapi
+
+import (
+	"github.com/goccy/go-json"
+	"github.com/mlctrez/ehugo/color"
+	"slices"
+)
+
+const (
+	TypeOnOffPlug        = "On/Off plug-in unit"
+	TypeDimmable         = "Dimmable light"
+	TypeColorTemperature = "Color temperature light"
+	TypeColor            = "Color light"
+	TypeExtendedColor    = "Extended color light"
+)
+
+// Profile describes what a light type reports and accepts.
+type Profile struct {
+	Type    string
+	ModelID string
+	// State lists the LightState attributes present in json, which are also the StateChange attributes accepted.
+	State       []string
+	CtMin       uint16
+	CtMax       uint16
+	MinDimLevel int
+	MaxLumen    int
+}
+
+var profiles = map[string]*Profile{
+	TypeOnOffPlug: {
+		Type:    TypeOnOffPlug,
+		ModelID: "LOM001",
+		State:   []string{"on", "alert", "mode", "reachable"},
+	},
+	TypeDimmable: {
+		Type:        TypeDimmable,
+		ModelID:     "LWB010",
+		State:       []string{"on", "bri", "alert", "mode", "reachable"},
+		MinDimLevel: 5000,
+		MaxLumen:    806,
+	},
+	TypeColorTemperature: {
+		Type:        TypeColorTemperature,
+		ModelID:     "LTW001",
+		State:       []string{"on", "bri", "ct", "alert", "colormode", "mode", "reachable"},
+		CtMin:       153,
+		CtMax:       454,
+		MinDimLevel: 1000,
+		MaxLumen:    806,
+	},
+	TypeColor: {
+		Type:        TypeColor,
+		ModelID:     "LLC011",
+		State:       []string{"on", "bri", "hue", "sat", "effect", "xy", "alert", "colormode", "mode", "reachable"},
+		MinDimLevel: 10000,
+		MaxLumen:    120,
+	},
+	TypeExtendedColor: {
+		Type:    TypeExtendedColor,
+		ModelID: "LCT007",
+		State: []string{"on", "bri", "hue", "sat", "effect", "xy", "ct", "alert", "colormode", "mode",
+			"reachable"},
+		CtMin:       153,
+		CtMax:       500,
+		MinDimLevel: 2000,
+		MaxLumen:    800,
+	},
+}
+
+// ProfileFor returns the profile of a light type.
+func ProfileFor(lightType string) (*Profile, bool) {
+	profile, ok := profiles[lightType]
+	return profile, ok
+}
+
+// profileFor returns the profile of a light type, lights of unknown types behave as extended color lights.
+func profileFor(lightType string) *Profile {
+	if profile, ok := profiles[lightType]; ok {
+		return profile
+	}
+	return profiles[TypeExtendedColor]
+}
+
+func (p *Profile) supports(attribute string) bool {
+	return slices.Contains(p.State, attribute)
+}
+
+// colorMode is the initial colormode of a light, empty for lights without color.
+func (p *Profile) colorMode() string {
+	switch {
+	case p.supports("ct"):
+		return "ct"
+	case p.supports("xy"):
+		return "xy"
+	}
+	return ""
+}
+
+// stateChangeAttributes returns the attributes set in a change with the LightState attribute they modify.
+func stateChangeAttributes(change *StateChange) map[string]string {
+	attributes := make(map[string]string)
+	set := func(isSet bool, name, attribute string) {
+		if isSet {
+			attributes[name] = attribute
+		}
+	}
+	set(change.On != nil, "on", "on")
+	set(change.Bri != nil, "bri", "bri")
+	set(change.BriInc != nil, "bri_inc", "bri")
+	set(change.Hue != nil, "hue", "hue")
+	set(change.HueInc != nil, "hue_inc", "hue")
+	set(change.Sat != nil, "sat", "sat")
+	set(change.SatInc != nil, "sat_inc", "sat")
+	set(change.XY != nil, "xy", "xy")
+	set(change.XYInc != nil, "xy_inc", "xy")
+	set(change.Ct != nil, "ct", "ct")
+	set(change.CtInc != nil, "ct_inc", "ct")
+	set(change.Effect != nil, "effect", "effect")
+	set(change.Alert != nil, "alert", "alert")
+	return attributes
+}
+
+// unsupported returns an error 6 entry for each attribute of change the profile does not accept.
+func (p *Profile) unsupported(basePath string, change *StateChange) []map[string]interface{} {
+	attributes := stateChangeAttributes(change)
+	var response []map[string]interface{}
+	for _, name := range sortedIds(attributes) {
+		if !p.supports(attributes[name]) {
+			response = append(response, map[string]interface{}{
+				"error": NewError(ErrorParameterNotAvailable, basePath+"/"+name, name),
+			})
+		}
+	}
+	return response
+}
+
+// filter returns a copy of change without the attributes the profile does not accept.
+func (p *Profile) filter(change *StateChange) *StateChange {
+	filtered := *change
+	if !p.supports("bri") {
+		filtered.Bri, filtered.BriInc = nil, nil
+	}
+	if !p.supports("hue") {
+		filtered.Hue, filtered.HueInc = nil, nil
+	}
+	if !p.supports("sat") {
+		filtered.Sat, filtered.SatInc = nil, nil
+	}
+	if !p.supports("xy") {
+		filtered.XY, filtered.XYInc = nil, nil
+	}
+	if !p.supports("ct") {
+		filtered.Ct, filtered.CtInc = nil, nil
+	}
+	if !p.supports("effect") {
+		filtered.Effect = nil
+	}
+	if !p.supports("alert") {
+		filtered.Alert = nil
+	}
+	return &filtered
+}
+
+// Capabilities are reported by lights to tell apps which controls to show.
+type Capabilities struct {
+	Certified bool                `json:"certified"`
+	Control   ControlCapabilities `json:"control"`
+	Streaming StreamingCapability `json:"streaming"`
+}
+
+type ControlCapabilities struct {
+	MinDimLevel    int          `json:"mindimlevel,omitempty"`
+	MaxLumen       int          `json:"maxlumen,omitempty"`
+	ColorGamutType string       `json:"colorgamuttype,omitempty"`
+	ColorGamut     [][2]float64 `json:"colorgamut,omitempty"`
+	Ct             *CtRange     `json:"ct,omitempty"`
+}
+
+type CtRange struct {
+	Min uint16 `json:"min"`
+	Max uint16 `json:"max"`
+}
+
+type StreamingCapability struct {
+	Renderer bool `json:"renderer"`
+	Proxy    bool `json:"proxy"`
+}
+
+func (p *Profile) capabilities(modelID string) Capabilities {
+	capabilities := Capabilities{
+		Certified: true,
+		Control:   ControlCapabilities{MinDimLevel: p.MinDimLevel, MaxLumen: p.MaxLumen},
+	}
+	if p.supports("xy") {
+		gamut := color.GamutForModel(modelID)
+		capabilities.Control.ColorGamutType = color.GamutType(gamut)
+		capabilities.Control.ColorGamut = [][2]float64{
+			{gamut.Red.X, gamut.Red.Y}, {gamut.Green.X, gamut.Green.Y}, {gamut.Blue.X, gamut.Blue.Y},
+		}
+		capabilities.Streaming = StreamingCapability{Renderer: true, Proxy: true}
+	}
+	if p.supports("ct") {
+		capabilities.Control.Ct = &CtRange{Min: p.CtMin, Max: p.CtMax}
+	}
+	return capabilities
+}
+
+// lightView is how the API reports a light, with only the state attributes of the light type and
+// with its capabilities. Lights are stored as the plain LightInfo.
+type lightView LightInfo
+
+// lightViews returns the API view of lights.
+func lightViews(lights map[string]*LightInfo) map[string]*lightView {
+	result := make(map[string]*lightView, len(lights))
+	for id, light := range lights {
+		result[id] = (*lightView)(light)
+	}
+	return result
+}
+
+func (l lightView) MarshalJSON() ([]byte, error) {
+	type plain LightInfo
+	profile := profileFor(l.Type)
+	state, err := profile.filterState(l.State)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		plain
+		State        map[string]json.RawMessage `json:"state"`
+		Capabilities Capabilities               `json:"capabilities"`
+	}{plain(l), state, profile.capabilities(l.ModelID)})
+}
+
+// StateJSON returns the state of the light as the API reports it, with only the attributes of the
+// light type.
+func (l *LightInfo) StateJSON() ([]byte, error) {
+	state, err := profileFor(l.Type).filterState(l.State)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(state)
+}
+
+// filterState returns the JSON attributes of state the profile supports.
+func (p *Profile) filterState(state LightState) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]json.RawMessage{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	for attribute := range result {
+		if !p.supports(attribute) {
+			delete(result, attribute)
+		}
+	}
+	return result, nil
+}
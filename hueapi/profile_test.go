@@ -0,0 +1,89 @@
+package hueapi
+
+import (
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLightProfiles(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+
+	for _, tc := range []struct {
+		lightType string
+		modelID   string
+		state     []string
+	}{
+		{TypeOnOffPlug, "LOM001", []string{"on", "alert", "mode", "reachable"}},
+		{TypeDimmable, "LWB010", []string{"on", "bri", "alert", "mode", "reachable"}},
+		{TypeColorTemperature, "LTW001", []string{"on", "bri", "ct", "alert", "colormode", "mode", "reachable"}},
+		{TypeExtendedColor, "LCT007", []string{"on", "bri", "hue", "sat", "effect", "xy", "ct", "alert",
+			"colormode", "mode", "reachable"}},
+	} {
+		recorder := request(h, "PUT", "/api/"+user+"/lights", `{"name":"`+tc.lightType+`","type":"`+tc.lightType+`"}`)
+		created := map[string]map[string]any{}
+		assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created), tc.lightType)
+		for _, light := range created {
+			assert.Equal(t, tc.modelID, light["modelid"], tc.lightType)
+			state := light["state"].(map[string]any)
+			assert.Len(t, state, len(tc.state), tc.lightType)
+			for _, attribute := range tc.state {
+				assert.Contains(t, state, attribute, tc.lightType)
+			}
+			assert.Contains(t, light, "capabilities", tc.lightType)
+		}
+	}
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/lights", `{"name":"Toaster","type":"Toaster"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+	}
+}
+
+func TestLightProfileStateChange(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+
+	_, plugId, err := h.PutLight(&LightInfo{Name: "Plug", Type: TypeOnOffPlug})
+	assert.NoError(t, err)
+	_, lampId, err := h.PutLight(&LightInfo{Name: "Lamp", Type: TypeColorTemperature})
+	assert.NoError(t, err)
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights/"+plugId+"/state", `{"on":false,"bri":100}`)
+	assert.JSONEq(t, `[{"error":{"type":6,"address":"/lights/1/state/bri","description":"parameter, bri, not available"}},`+
+		`{"success":{"/lights/1/state/on":false}}]`, recorder.Body.String())
+
+	// ct is limited to the range of the profile
+	recorder = request(h, "PUT", "/api/"+user+"/lights/"+lampId+"/state", `{"ct_inc":500}`)
+	assert.JSONEq(t, `[{"success":{"/lights/2/state/ct":454}}]`, recorder.Body.String())
+
+	// group actions skip attributes a light does not support
+	request(h, "PUT", "/api/"+user+"/groups/0/action", `{"on":true,"bri":10}`)
+	plug, err := h.GetLight(plugId)
+	assert.NoError(t, err)
+	assert.True(t, plug.State.On)
+	assert.NotEqual(t, uint8(10), plug.State.Bri)
+	lamp, err := h.GetLight(lampId)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(10), lamp.State.Bri)
+
+	// capabilities follow the profile
+	data, err := json.Marshal((*lightView)(lamp))
+	assert.NoError(t, err)
+	info := map[string]any{}
+	assert.NoError(t, json.Unmarshal(data, &info))
+	control := info["capabilities"].(map[string]any)["control"].(map[string]any)
+	assert.Equal(t, map[string]any{"min": float64(153), "max": float64(454)}, control["ct"])
+	assert.NotContains(t, control, "colorgamut")
+
+	// lights are stored with their whole state and without the API additions
+	assert.NoError(t, h.store.View(func(tx Tx) error {
+		stored := map[string]any{}
+		assert.NoError(t, json.Unmarshal(tx.Bucket("lights").Get(plugId), &stored))
+		assert.NotContains(t, stored, "capabilities")
+		assert.Contains(t, stored["state"], "bri")
+		return nil
+	}))
+}
@@ -0,0 +1,262 @@
+package hueapi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// https://developers.meethue.com/develop/hue-api/4-scenes/
+
+type SceneInfo struct {
+	Name        string                `json:"name"`
+	Type        string                `json:"type"`
+	Group       string                `json:"group,omitempty"`
+	Lights      []string              `json:"lights"`
+	Owner       string                `json:"owner"`
+	Recycle     bool                  `json:"recycle"`
+	Locked      bool                  `json:"locked"`
+	AppData     map[string]any        `json:"appdata"`
+	Picture     string                `json:"picture"`
+	LastUpdated string                `json:"lastupdated"`
+	Version     int                   `json:"version"`
+	LightStates map[string]LightState `json:"lightstates,omitempty"`
+}
+
+// SceneChange holds the scene attributes of a create or update request.
+type SceneChange struct {
+	Name            *string                 `json:"name,omitempty"`
+	Type            *string                 `json:"type,omitempty"`
+	Group           *string                 `json:"group,omitempty"`
+	Lights          []string                `json:"lights,omitempty"`
+	Recycle         *bool                   `json:"recycle,omitempty"`
+	AppData         map[string]any          `json:"appdata,omitempty"`
+	Picture         *string                 `json:"picture,omitempty"`
+	LightStates     map[string]*StateChange `json:"lightstates,omitempty"`
+	StoreLightState *bool                   `json:"storelightstate,omitempty"`
+}
+
+func newSceneId() (string, error) {
+	data := make([]byte, 8)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// change returns the StateChange that restores the state, limited to the fields of the color mode.
+func (s LightState) change() *StateChange {
+	change := &StateChange{On: &s.On, Bri: &s.Bri}
+	switch s.ColorMode {
+	case "hs":
+		change.Hue, change.Sat = &s.Hue, &s.Sat
+	case "xy":
+		change.XY = s.XY
+	case "ct":
+		change.Ct = &s.Ct
+	}
+	return change
+}
+
+// apply sets the attributes in change on the scene, validating them against the known lights and groups.
+func (s *SceneInfo) apply(id string, change *SceneChange, lights map[string]*LightInfo, groups map[string]*GroupInfo) ([]map[string]interface{}, error) {
+	var response []map[string]interface{}
+	basePath := fmt.Sprintf("/scenes/%s", id)
+	success := func(attribute string, value any) {
+		response = append(response, map[string]interface{}{
+			"success": map[string]interface{}{basePath + "/" + attribute: value},
+		})
+	}
+
+	if change.Type != nil {
+		if *change.Type != "LightScene" && *change.Type != "GroupScene" {
+			return nil, NewError(ErrorInvalidValue, basePath+"/type", *change.Type, "type")
+		}
+		s.Type = *change.Type
+	}
+	if s.Type == "" {
+		s.Type = "LightScene"
+	}
+	if change.Group != nil {
+		group, ok := groups[*change.Group]
+		if !ok || s.Type != "GroupScene" {
+			return nil, NewError(ErrorInvalidValue, basePath+"/group", *change.Group, "group")
+		}
+		s.Group = *change.Group
+		s.Lights = slices.Clone(group.Lights)
+	}
+	if s.Type == "GroupScene" && s.Group == "" {
+		return nil, NewError(ErrorMissingParameters, basePath)
+	}
+	if change.Name != nil {
+		if *change.Name == "" || len(*change.Name) > 32 {
+			return nil, NewError(ErrorInvalidValue, basePath+"/name", *change.Name, "name")
+		}
+		s.Name = *change.Name
+		success("name", s.Name)
+	}
+	if change.Lights != nil {
+		if s.Type == "GroupScene" {
+			return nil, NewError(ErrorParameterNotModifiable, basePath+"/lights", "lights")
+		}
+		s.Lights = make([]string, 0, len(change.Lights))
+		for _, lightId := range change.Lights {
+			if _, ok := lights[lightId]; !ok {
+				return nil, NewError(ErrorInvalidValue, basePath+"/lights", lightId, "lights")
+			}
+			if !slices.Contains(s.Lights, lightId) {
+				s.Lights = append(s.Lights, lightId)
+			}
+		}
+		success("lights", s.Lights)
+	}
+	if change.Recycle != nil {
+		s.Recycle = *change.Recycle
+	}
+	if change.AppData != nil {
+		s.AppData = change.AppData
+		success("appdata", s.AppData)
+	}
+	if change.Picture != nil {
+		s.Picture = *change.Picture
+		success("picture", s.Picture)
+	}
+
+	// keep only the states of scene lights, capturing the current state of new ones
+	states := make(map[string]LightState, len(s.Lights))
+	for _, lightId := range s.Lights {
+		state, ok := s.LightStates[lightId]
+		if !ok || (change.StoreLightState != nil && *change.StoreLightState) {
+			state = lights[lightId].State
+		}
+		states[lightId] = state
+	}
+	s.LightStates = states
+	if change.StoreLightState != nil {
+		success("storelightstate", *change.StoreLightState)
+	}
+
+	for _, lightId := range sortedIds(change.LightStates) {
+		if _, ok := s.LightStates[lightId]; !ok {
+			return nil, NewError(ErrorInvalidValue, basePath+"/lightstates", lightId, "lightstates")
+		}
+		if _, err := s.applyLightState(id, lightId, lights[lightId], change.LightStates[lightId]); err != nil {
+			return nil, err
+		}
+	}
+
+	s.LastUpdated = time.Now().UTC().Format(hueTimeFormat)
+	s.Version = 2
+	return response, nil
+}
+
+// applyLightState validates and applies the change to the stored state of a single scene light the
+// same way as a change of the light itself.
+func (s *SceneInfo) applyLightState(id, lightId string, light *LightInfo, change *StateChange) ([]map[string]interface{}, error) {
+	basePath := fmt.Sprintf("/scenes/%s/lightstates/%s", id, lightId)
+	if err := change.Validate(basePath); err != nil {
+		return nil, err
+	}
+	profile := profileFor(light.Type)
+	response := profile.unsupported(basePath, change)
+	stored := &LightInfo{Type: light.Type, ModelID: light.ModelID, State: s.LightStates[lightId]}
+	response = append(response, stored.applyStateChange(basePath, profile.filter(change))...)
+	s.LightStates[lightId] = stored.State
+	return response, nil
+}
+
+func (h *HueApi) Scenes(c *gin.Context) {
+	scenes, err := h.GetScenes()
+	if err != nil {
+		abortWithError(c, "/scenes", err)
+		return
+	}
+	// like a real bridge the light states are only returned for a single scene
+	for _, scene := range scenes {
+		scene.LightStates = nil
+	}
+	c.JSON(http.StatusOK, scenes)
+}
+
+func (h *HueApi) Scene(c *gin.Context) {
+	sceneId := c.Param("sceneId")
+	scene, err := h.GetScene(sceneId)
+	if err != nil {
+		abortWithError(c, "/scenes/"+sceneId, err)
+		return
+	}
+	c.JSON(http.StatusOK, scene)
+}
+
+func (h *HueApi) ApiCreateScene(c *gin.Context) {
+	change := &SceneChange{}
+	if err := c.ShouldBindJSON(change); err != nil {
+		abortWithErrors(c, bindError("/scenes", err))
+		return
+	}
+	if change.Name == nil || (change.Lights == nil && change.Group == nil) {
+		abortWithErrors(c, NewError(ErrorMissingParameters, "/scenes"))
+		return
+	}
+	sceneId, err := h.CreateScene(c.Param("user"), change)
+	if err != nil {
+		abortWithError(c, "/scenes", err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": gin.H{"id": sceneId}}})
+}
+
+func (h *HueApi) ApiUpdateScene(c *gin.Context) {
+	sceneId := c.Param("sceneId")
+	change := &SceneChange{}
+	if err := c.ShouldBindJSON(change); err != nil {
+		abortWithErrors(c, bindError("/scenes/"+sceneId, err))
+		return
+	}
+	var errs []*HueError
+	if change.Type != nil {
+		errs = append(errs, NewError(ErrorParameterNotModifiable, "/scenes/"+sceneId+"/type", "type"))
+	}
+	if change.Group != nil {
+		errs = append(errs, NewError(ErrorParameterNotModifiable, "/scenes/"+sceneId+"/group", "group"))
+	}
+	if len(errs) > 0 {
+		abortWithErrors(c, errs...)
+		return
+	}
+	response, err := h.UpdateScene(sceneId, change)
+	if err != nil {
+		abortWithError(c, "/scenes/"+sceneId, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *HueApi) ApiSceneLightState(c *gin.Context) {
+	sceneId, lightId := c.Param("sceneId"), c.Param("lightId")
+	address := fmt.Sprintf("/scenes/%s/lightstates/%s", sceneId, lightId)
+	change := &StateChange{}
+	if err := c.ShouldBindJSON(change); err != nil {
+		abortWithErrors(c, bindError(address, err))
+		return
+	}
+	response, err := h.UpdateSceneLightState(sceneId, lightId, change)
+	if err != nil {
+		abortWithError(c, address, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *HueApi) ApiDeleteScene(c *gin.Context) {
+	sceneId := c.Param("sceneId")
+	if err := h.DeleteScene(sceneId); err != nil {
+		abortWithError(c, "/scenes/"+sceneId, err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": fmt.Sprintf("/scenes/%s deleted", sceneId)}})
+}
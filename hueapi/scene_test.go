@@ -0,0 +1,147 @@
+package hueapi
+
+import (
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSceneRecall(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall", "Den")
+
+	// capture the current states, then adjust one of them
+	recorder := request(h, "POST", "/api/"+user+"/scenes",
+		`{"name":"Evening","lights":["1","2"],"lightstates":{"2":{"on":false}}}`)
+	var created []map[string]map[string]string
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+	sceneId := created[0]["success"]["id"]
+	assert.NotEmpty(t, sceneId)
+
+	recorder = request(h, "PUT", "/api/"+user+"/scenes/"+sceneId+"/lightstates/1", `{"bri":50,"ct":400}`)
+	assert.JSONEq(t, `[{"success":{"/scenes/`+sceneId+`/lightstates/1/bri":50}},`+
+		`{"success":{"/scenes/`+sceneId+`/lightstates/1/ct":400}}]`, recorder.Body.String())
+
+	scene, err := h.GetScene(sceneId)
+	assert.NoError(t, err)
+	assert.Equal(t, user, scene.Owner)
+	assert.Equal(t, "LightScene", scene.Type)
+	assert.Equal(t, []string{"1", "2"}, scene.Lights)
+	assert.Len(t, scene.LightStates, 2)
+
+	var events []*LightEvent
+	h.AddLightCallback(func(e *LightEvent) { events = append(events, e) })
+
+	recorder = request(h, "PUT", "/api/"+user+"/groups/0/action", `{"scene":"`+sceneId+`"}`)
+	assert.JSONEq(t, `[{"success":{"/groups/0/action/scene":"`+sceneId+`"}}]`, recorder.Body.String())
+
+	lights, err := h.GetLights()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(50), lights["1"].State.Bri)
+	assert.Equal(t, uint16(400), lights["1"].State.Ct)
+	assert.False(t, lights["2"].State.On)
+	assert.True(t, lights["3"].State.On)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, uint8(50), *events[0].Change.Bri)
+		assert.False(t, *events[1].Change.On)
+	}
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/groups/0/action", `{"scene":"missing"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+	}
+
+	// the list omits light states and deleted lights are removed from scenes
+	assert.NotContains(t, request(h, "GET", "/api/"+user+"/scenes", "").Body.String(), "lightstates")
+	assert.NoError(t, h.DeleteLight("2"))
+	scene, err = h.GetScene(sceneId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, scene.Lights)
+	assert.Len(t, scene.LightStates, 1)
+
+	recorder = request(h, "DELETE", "/api/"+user+"/scenes/"+sceneId, "")
+	assert.JSONEq(t, `[{"success":"/scenes/`+sceneId+` deleted"}]`, recorder.Body.String())
+}
+
+func TestGroupSceneStoreLightState(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall")
+
+	groupId, err := h.CreateGroup(&GroupChange{Lights: []string{"2"}})
+	assert.NoError(t, err)
+
+	name, sceneType := "Relax", "GroupScene"
+	sceneId, err := h.CreateScene(user, &SceneChange{Name: &name, Type: &sceneType, Group: &groupId})
+	assert.NoError(t, err)
+
+	bri := uint8(7)
+	_, err = h.ChangeLightState("2", &StateChange{Bri: &bri})
+	assert.NoError(t, err)
+
+	recorder := request(h, "PUT", "/api/"+user+"/scenes/"+sceneId, `{"storelightstate":true}`)
+	assert.JSONEq(t, `[{"success":{"/scenes/`+sceneId+`/storelightstate":true}}]`, recorder.Body.String())
+
+	scene, err := h.GetScene(sceneId)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, scene.Lights)
+	assert.Equal(t, uint8(7), scene.LightStates["2"].Bri)
+
+	errs := hueErrors(t, request(h, "PUT", "/api/"+user+"/scenes/"+sceneId, `{"group":"0"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorParameterNotModifiable, errs[0].Type)
+		assert.Equal(t, "/scenes/"+sceneId+"/group", errs[0].Address)
+		assert.Equal(t, "parameter, group, is not modifiable", errs[0].Description)
+	}
+	errs = hueErrors(t, request(h, "PUT", "/api/"+user+"/scenes/"+sceneId, `{"type":"LightScene"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "/scenes/"+sceneId+"/type", errs[0].Address)
+	}
+}
+
+func TestSceneLightStateValidate(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen")
+	_, plugId, err := h.PutLight(&LightInfo{Name: "Plug", Type: TypeOnOffPlug})
+	require.NoError(t, err)
+
+	errs := hueErrors(t, request(h, "POST", "/api/"+user+"/scenes",
+		`{"name":"Evening","lights":["1"],"lightstates":{"1":{"effect":"sparkle"}}}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorInvalidValue, errs[0].Type)
+	}
+	scenes, err := h.GetScenes()
+	require.NoError(t, err)
+	assert.Empty(t, scenes)
+
+	name := "Evening"
+	sceneId, err := h.CreateScene(user, &SceneChange{Name: &name, Lights: []string{"1", plugId}})
+	require.NoError(t, err)
+	address := "/scenes/" + sceneId + "/lightstates/"
+	for body, attribute := range map[string]string{
+		`{"effect":"sparkle"}`: "effect",
+		`{"alert":"blink"}`:    "alert",
+		`{"xy":[0.2,1.5]}`:     "xy",
+		`{"ct":600}`:           "ct",
+		`{"bri_inc":300}`:      "bri_inc",
+	} {
+		errs = hueErrors(t, request(h, "PUT", "/api/"+user+address+"1", body))
+		if assert.Len(t, errs, 1, body) {
+			assert.Equal(t, ErrorInvalidValue, errs[0].Type, body)
+			assert.Equal(t, address+"1/"+attribute, errs[0].Address, body)
+		}
+	}
+
+	// attributes the light does not support are reported and not stored
+	recorder := request(h, "PUT", "/api/"+user+address+plugId, `{"on":false,"bri":100}`)
+	assert.JSONEq(t, `[{"error":{"type":6,"address":"`+address+plugId+`/bri","description":"parameter, bri, not available"}},`+
+		`{"success":{"`+address+plugId+`/on":false}}]`, recorder.Body.String())
+	scene, err := h.GetScene(sceneId)
+	require.NoError(t, err)
+	assert.NotEqual(t, uint8(100), scene.LightStates[plugId].Bri)
+	assert.False(t, scene.LightStates[plugId].On)
+}
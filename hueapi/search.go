@@ -0,0 +1,135 @@
+package hueapi
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// https://developers.meethue.com/develop/hue-api/lights-api/#search-for-new-lights
+
+// searchDuration is how long a search for new lights stays active.
+const searchDuration = 40 * time.Second
+
+// StartSearch starts a search for new lights, staged lights are discovered right away.
+// A search that is already active is not restarted.
+func (h *HueApi) StartSearch() error {
+	h.mu.Lock()
+	if time.Now().Before(h.searchUntil) {
+		h.mu.Unlock()
+		return nil
+	}
+	h.searchStart = time.Now()
+	h.searchUntil = h.searchStart.Add(searchDuration)
+	h.newLights = make(map[string]string)
+	h.mu.Unlock()
+	return h.discover()
+}
+
+// Searching reports whether a search for new lights is active.
+func (h *HueApi) Searching() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Now().Before(h.searchUntil)
+}
+
+// discover adds the staged lights to the lights found by the current search.
+func (h *HueApi) discover() error {
+	adopted, err := h.adoptStaged()
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for id, name := range adopted {
+		h.newLights[id] = name
+	}
+	return nil
+}
+
+// NewLights returns the lights found by the last search and the lastscan value of GET /lights/new.
+func (h *HueApi) NewLights() (map[string]string, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	lights := make(map[string]string, len(h.newLights))
+	for id, name := range h.newLights {
+		lights[id] = name
+	}
+	switch {
+	case h.searchStart.IsZero():
+		return lights, "none"
+	case time.Now().Before(h.searchUntil):
+		return lights, "active"
+	}
+	return lights, h.searchStart.UTC().Format(hueTimeFormat)
+}
+
+func (h *HueApi) ApiSearchLights(c *gin.Context) {
+	if err := h.StartSearch(); err != nil {
+		abortWithError(c, "/lights", err)
+		return
+	}
+	c.JSON(http.StatusOK, []gin.H{{"success": gin.H{"/lights": "Searching for new devices"}}})
+}
+
+func (h *HueApi) ApiNewLights(c *gin.Context) {
+	lights, lastScan := h.NewLights()
+	response := gin.H{"lastscan": lastScan}
+	for id, name := range lights {
+		response[id] = gin.H{"name": name}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *HueApi) AdminStaged(c *gin.Context) {
+	staged, err := h.GetStaged()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, staged)
+}
+
+func (h *HueApi) AdminStageLight(c *gin.Context) {
+	light := &LightInfo{}
+	if err := c.ShouldBindJSON(light); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if light.Name == "" {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if _, ok := ProfileFor(light.Type); light.Type != "" && !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "unknown light type " + light.Type})
+		return
+	}
+	if err := h.StageLight(light); err != nil {
+		if strings.Contains(err.Error(), "already exists") {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	// lights staged while a search is active are found by it
+	if h.Searching() {
+		if err := h.discover(); err != nil {
+			h.logger.Errorf("discover staged lights: %v", err)
+		}
+	}
+	c.JSON(http.StatusOK, light)
+}
+
+func (h *HueApi) AdminDeleteStaged(c *gin.Context) {
+	if err := h.DeleteStaged(c.Param("name")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,62 @@
+package hueapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchNewLights(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	recorder := request(h, "GET", "/api/"+user+"/lights/new", "")
+	assert.JSONEq(t, `{"lastscan":"none"}`, recorder.Body.String())
+
+	recorder = adminRequest(h, "PUT", "/admin/staged", `{"name":"Porch","type":"On/Off plug-in unit"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = adminRequest(h, "PUT", "/admin/staged", `{"name":"Porch"}`)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = adminRequest(h, "PUT", "/admin/staged", `{"name":"Lamp"}`)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	recorder = adminRequest(h, "PUT", "/admin/staged", `{"name":"Spare"}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, http.StatusOK, adminRequest(h, "DELETE", "/admin/staged/Spare", "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(h, "DELETE", "/admin/staged/Spare", "").Code)
+
+	staged := map[string]*LightInfo{}
+	assert.NoError(t, json.Unmarshal(adminRequest(h, "GET", "/admin/staged", "").Body.Bytes(), &staged))
+	assert.Contains(t, staged, "Porch")
+
+	// staged lights are not visible until a search finds them
+	_, err := h.GetLight("2")
+	assert.Error(t, err)
+
+	recorder = request(h, "POST", "/api/"+user+"/lights", "")
+	assert.JSONEq(t, `[{"success":{"/lights":"Searching for new devices"}}]`, recorder.Body.String())
+	recorder = request(h, "GET", "/api/"+user+"/lights/new", "")
+	assert.JSONEq(t, `{"lastscan":"active","2":{"name":"Porch"}}`, recorder.Body.String())
+
+	light, err := h.GetLight("2")
+	assert.NoError(t, err)
+	assert.Equal(t, TypeOnOffPlug, light.Type)
+	assert.Equal(t, "LOM001", light.ModelID)
+
+	// lights staged during the search are found as well
+	adminRequest(h, "PUT", "/admin/staged", `{"name":"Garage"}`)
+	recorder = request(h, "GET", "/api/"+user+"/lights/new", "")
+	assert.JSONEq(t, `{"lastscan":"active","2":{"name":"Porch"},"3":{"name":"Garage"}}`, recorder.Body.String())
+	staged, err = h.GetStaged()
+	assert.NoError(t, err)
+	assert.Empty(t, staged)
+
+	// once the search ends lastscan reports its start time
+	h.mu.Lock()
+	h.searchUntil = h.searchStart
+	h.mu.Unlock()
+	_, lastScan := h.NewLights()
+	assert.Equal(t, h.searchStart.UTC().Format(hueTimeFormat), lastScan)
+}
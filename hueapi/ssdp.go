@@ -2,29 +2,45 @@ package hueapi
 
 import (
 	"github.com/mlctrez/ehugo/ssdp"
-	"strings"
+	"time"
 )
 
+// SetSSDPFilter limits the clients and search targets that SSDP searches are answered for.
+func (h *HueApi) SetSSDPFilter(filter *ssdp.Filter) {
+	h.ssdpFilter = filter
+}
+
+// SetSSDPVerbose logs every SSDP search along with whether it was answered.
+func (h *HueApi) SetSSDPVerbose(verbose bool) {
+	h.ssdpVerbose = verbose
+}
+
 func (h *HueApi) SSDPCallback(p *ssdp.Packet) {
-	var err error
-	if err = p.Parse(); err != nil {
+	if err := p.Parse(); err != nil {
 		h.logger.Errorf("SSDPCallback parse error: %s", err)
 		return
 	}
 
-	// limit to one device to avoid so much logging
-	if !strings.HasPrefix(p.Client.String(), "10.0.0.45:") {
+	if p.Method != "M-SEARCH" {
 		return
 	}
-
-	if p.Method != "M-SEARCH" || strings.Contains(p.MIMEHeader.Get("St"), "dial-multiscreen-org") {
+	if !h.ssdpFilter.Allows(p.Client.IP, p.MIMEHeader.Get("St")) {
+		if h.ssdpVerbose {
+			h.logger.Infof("SSDPCallback client=%s st=%s filtered", p.Client.String(), p.MIMEHeader.Get("St"))
+		}
 		return
 	}
-	h.logger.Infof("SSDPCallback client=%s method=%s headers=%+v", p.Client.String(), p.Method, p.MIMEHeader)
+	delay := p.Delay()
+	if h.ssdpVerbose {
+		h.logger.Infof("SSDPCallback client=%s method=%s delay=%s headers=%+v", p.Client.String(), p.Method, delay, p.MIMEHeader)
+	}
 
-	for _, bridge := range h.bridges {
-		if err = p.Reply(bridge); err != nil {
-			h.logger.Errorf("ssdpCallback reply error: %s", err)
+	// reply after the delay without blocking the reading of further packets
+	time.AfterFunc(delay, func() {
+		for _, bridge := range h.bridges {
+			if err := p.Reply(bridge); err != nil {
+				h.logger.Errorf("ssdpCallback reply error: %s", err)
+			}
 		}
-	}
+	})
 }
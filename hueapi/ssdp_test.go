@@ -0,0 +1,61 @@
+package hueapi
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mlctrez/ehugo/ssdp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mSearch = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 1\r\n" +
+	"ST: %s\r\n\r\n"
+
+// search passes an M-SEARCH for st to the callback and returns the reply, if any. The reply is
+// sent after a random delay of up to MX.
+func search(t *testing.T, h *HueApi, st string) string {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	data := strings.Replace(mSearch, "%s", st, 1)
+	start := time.Now()
+	h.SSDPCallback(&ssdp.Packet{Client: conn.LocalAddr().(*net.UDPAddr), Data: []byte(data)})
+	// the delay does not block the callback
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+	buffer := make([]byte, 2048)
+	require.NoError(t, conn.SetReadDeadline(start.Add(time.Second+200*time.Millisecond)))
+	n, _, err := conn.ReadFromUDP(buffer)
+	if err != nil {
+		return ""
+	}
+	return string(buffer[:n])
+}
+
+func TestSSDPCallbackFilter(t *testing.T) {
+	h := setupTestApi(t)
+	h.bridges = []*ssdp.BridgeInfo{{SerialNumber: "001788FFFE23BFC1", UUID: "2f402f80-da50-11e1-9b23-001788255acc"}}
+	h.SetSSDPFilter(ssdp.DefaultFilter())
+	h.SetSSDPVerbose(true)
+
+	assert.Contains(t, search(t, h, "upnp:rootdevice"), "hue-bridgeid: 001788FFFE23BFC1")
+	assert.Empty(t, search(t, h, "urn:dial-multiscreen-org:service:dial:1"))
+
+	allowed, err := ssdp.ParseCIDRs("10.0.0.0/24")
+	require.NoError(t, err)
+	h.SetSSDPFilter(&ssdp.Filter{AllowCIDRs: allowed})
+	assert.Empty(t, search(t, h, "upnp:rootdevice"))
+
+	allowed, err = ssdp.ParseCIDRs("127.0.0.1")
+	require.NoError(t, err)
+	h.SetSSDPFilter(&ssdp.Filter{AllowCIDRs: allowed, DenyST: []string{"ssdp:*"}})
+	assert.NotEmpty(t, search(t, h, "upnp:rootdevice"))
+	assert.Empty(t, search(t, h, "ssdp:all"))
+}
@@ -0,0 +1,417 @@
+package hueapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.etcd.io/bbolt"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// Store persists the lights, groups, scenes, users and remaining data of the bridge as JSON values
+// in named buckets. The changes of a read-write transaction are committed together or not at all.
+type Store interface {
+	// Update runs fn in a read-write transaction, an error returned by fn discards all changes and is returned.
+	Update(fn func(tx Tx) error) error
+	// View runs fn in a read-only transaction with a consistent view of all buckets.
+	View(fn func(tx Tx) error) error
+}
+
+// Tx is a transaction of a Store.
+type Tx interface {
+	// Bucket returns the bucket with name or nil when the store has no such bucket.
+	Bucket(name string) Bucket
+}
+
+// Bucket holds values by key within a transaction, returned values must not be modified.
+type Bucket interface {
+	Get(key string) []byte
+	Put(key string, value []byte) error
+	Delete(key string) error
+	// ForEach calls fn for each value in key order, fn must not modify the bucket.
+	ForEach(fn func(key string, value []byte) error) error
+}
+
+// clearBucket deletes all values of the bucket name.
+func clearBucket(tx Tx, name string) error {
+	bucket := tx.Bucket(name)
+	if bucket == nil {
+		return fmt.Errorf("bucket does not exist")
+	}
+	var keys []string
+	err := bucket.ForEach(func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err = bucket.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type boltStore struct {
+	db *bbolt.DB
+}
+
+// NewBoltStore returns a Store keeping each bucket in a bucket of db, the buckets are created
+// by the schema migrations of HueApi.SetupBolt.
+func NewBoltStore(db *bbolt.DB) Store {
+	return &boltStore{db: db}
+}
+
+func (s *boltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+func (s *boltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error { return fn(boltTx{tx}) })
+}
+
+type boltTx struct {
+	tx *bbolt.Tx
+}
+
+func (t boltTx) Bucket(name string) Bucket {
+	bucket := t.tx.Bucket([]byte(name))
+	if bucket == nil {
+		return nil
+	}
+	return boltBucket{bucket}
+}
+
+type boltBucket struct {
+	bucket *bbolt.Bucket
+}
+
+func (b boltBucket) Get(key string) []byte {
+	return b.bucket.Get([]byte(key))
+}
+
+func (b boltBucket) Put(key string, value []byte) error {
+	return b.bucket.Put([]byte(key), value)
+}
+
+func (b boltBucket) Delete(key string) error {
+	return b.bucket.Delete([]byte(key))
+}
+
+func (b boltBucket) ForEach(fn func(key string, value []byte) error) error {
+	return b.bucket.ForEach(func(k, v []byte) error { return fn(string(k), v) })
+}
+
+// MemoryStore keeps all buckets in memory, for tests and ephemeral runs. Every bucket exists
+// and starts out empty.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+// Update runs fn on a copy of the buckets that replaces them once fn succeeds.
+func (s *MemoryStore) Update(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := &memoryTx{buckets: maps.Clone(s.buckets), copied: make(map[string]bool)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.buckets = tx.buckets
+	return nil
+}
+
+func (s *MemoryStore) View(fn func(tx Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return fn(&memoryTx{buckets: s.buckets})
+}
+
+// memoryTx is a transaction of a MemoryStore, read-only when copied is nil. Buckets are shared
+// with the store until the transaction first changes them.
+type memoryTx struct {
+	buckets map[string]map[string][]byte
+	copied  map[string]bool
+}
+
+func (t *memoryTx) Bucket(name string) Bucket {
+	return &memoryBucket{tx: t, name: name}
+}
+
+type memoryBucket struct {
+	tx   *memoryTx
+	name string
+}
+
+// values returns the values of the bucket for a change, copied on the first change of the transaction.
+func (b *memoryBucket) values() (map[string][]byte, error) {
+	if b.tx.copied == nil {
+		return nil, fmt.Errorf("transaction is read-only")
+	}
+	if !b.tx.copied[b.name] {
+		values := maps.Clone(b.tx.buckets[b.name])
+		if values == nil {
+			values = make(map[string][]byte)
+		}
+		b.tx.buckets[b.name] = values
+		b.tx.copied[b.name] = true
+	}
+	return b.tx.buckets[b.name], nil
+}
+
+func (b *memoryBucket) Get(key string) []byte {
+	return b.tx.buckets[b.name][key]
+}
+
+func (b *memoryBucket) Put(key string, value []byte) error {
+	values, err := b.values()
+	if err != nil {
+		return err
+	}
+	values[key] = bytes.Clone(value)
+	return nil
+}
+
+func (b *memoryBucket) Delete(key string) error {
+	values, err := b.values()
+	if err != nil {
+		return err
+	}
+	delete(values, key)
+	return nil
+}
+
+func (b *memoryBucket) ForEach(fn func(key string, value []byte) error) error {
+	values := b.tx.buckets[b.name]
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if err := fn(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LightTx reads and writes the lights within a transaction of a Store. Errors for unknown lights
+// contain "not found" and errors for duplicate names contain "already exists".
+type LightTx interface {
+	// Lights returns all lights by id.
+	Lights() (map[string]*LightInfo, error)
+	// Light returns the light with id.
+	Light(id string) (*LightInfo, error)
+	// Insert stores a new light with defaults under a new id, the name must be unique.
+	Insert(light *LightInfo) (string, error)
+	// Modify runs modify on each of the lights and stores the results, an error returned by modify
+	// leaves all lights unchanged and is returned. The modified lights are returned by id.
+	Modify(ids []string, modify func(id string, light *LightInfo) error) (map[string]*LightInfo, error)
+	// Rename changes the name of a light, the name must be unique.
+	Rename(id string, name string) error
+	// Delete removes the light with id.
+	Delete(id string) error
+	// Replace replaces all lights with lights, keeping their ids.
+	Replace(lights map[string]*LightInfo) error
+}
+
+// lastLightIdKey holds the last assigned light id in the meta bucket, like a real bridge
+// ids of deleted lights are never assigned again so apps do not confuse old and new lights.
+const lastLightIdKey = "lastlightid"
+
+// lastLightId returns the highest of last and the numeric ids of lights.
+func lastLightId(last int, lights map[string]*LightInfo) int {
+	for id := range lights {
+		if n, err := strconv.Atoi(id); err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+func readLastLightId(tx Tx) (int, error) {
+	bucket := tx.Bucket(metaBucket)
+	if bucket == nil {
+		return 0, fmt.Errorf("bucket does not exist")
+	}
+	v := bucket.Get(lastLightIdKey)
+	if v == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(v))
+}
+
+func writeLastLightId(tx Tx, last int) error {
+	bucket := tx.Bucket(metaBucket)
+	if bucket == nil {
+		return fmt.Errorf("bucket does not exist")
+	}
+	return bucket.Put(lastLightIdKey, []byte(strconv.Itoa(last)))
+}
+
+// checkName returns an error when a light other than id already uses name.
+func checkName(lights map[string]*LightInfo, id string, name string) error {
+	for existingId, existing := range lights {
+		if existingId != id && existing.Name == name {
+			return fmt.Errorf("light with name %s already exists", name)
+		}
+	}
+	return nil
+}
+
+// checkNames returns an error when two of the lights use the same name.
+func checkNames(lights map[string]*LightInfo) error {
+	for id, light := range lights {
+		if err := checkName(lights, id, light.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lightTx accesses the lights bucket within a transaction.
+type lightTx struct {
+	tx Tx
+}
+
+func (l lightTx) Lights() (map[string]*LightInfo, error) {
+	return readLights(l.tx)
+}
+
+func readLights(tx Tx) (map[string]*LightInfo, error) {
+	result := make(map[string]*LightInfo)
+	bucket := tx.Bucket("lights")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	err := bucket.ForEach(func(k string, v []byte) error {
+		light := &LightInfo{}
+		if err := json.Unmarshal(v, light); err != nil {
+			return err
+		}
+		result[k] = light
+		return nil
+	})
+	return result, err
+}
+
+func (l lightTx) Light(id string) (*LightInfo, error) {
+	bucket := l.tx.Bucket("lights")
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket does not exist")
+	}
+	v := bucket.Get(id)
+	if v == nil {
+		return nil, fmt.Errorf("light %s not found", id)
+	}
+	result := new(LightInfo)
+	return result, json.Unmarshal(v, result)
+}
+
+func (l lightTx) Insert(light *LightInfo) (string, error) {
+	lights, err := readLights(l.tx)
+	if err != nil {
+		return "", err
+	}
+	if err = checkName(lights, "", light.Name); err != nil {
+		return "", err
+	}
+	last, err := readLastLightId(l.tx)
+	if err != nil {
+		return "", err
+	}
+	last = lastLightId(last, lights) + 1
+	if err = writeLastLightId(l.tx, last); err != nil {
+		return "", err
+	}
+	lightId := strconv.Itoa(last)
+	light.Defaults(lightId)
+	return lightId, writeLight(l.tx, lightId, light)
+}
+
+func (l lightTx) Modify(ids []string, modify func(id string, light *LightInfo) error) (map[string]*LightInfo, error) {
+	result := make(map[string]*LightInfo)
+	for _, id := range ids {
+		light, err := l.Light(id)
+		if err != nil {
+			return nil, err
+		}
+		if err = modify(id, light); err != nil {
+			return nil, err
+		}
+		result[id] = light
+	}
+	// only write once all modifications succeeded, the caller may still commit the transaction
+	for id, light := range result {
+		if err := writeLight(l.tx, id, light); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (l lightTx) Rename(id string, name string) error {
+	lights, err := readLights(l.tx)
+	if err != nil {
+		return err
+	}
+	light, ok := lights[id]
+	if !ok {
+		return fmt.Errorf("light %s not found", id)
+	}
+	if err = checkName(lights, id, name); err != nil {
+		return err
+	}
+	light.Name = name
+	return writeLight(l.tx, id, light)
+}
+
+func (l lightTx) Delete(id string) error {
+	bucket := l.tx.Bucket("lights")
+	if bucket == nil {
+		return fmt.Errorf("bucket does not exist")
+	}
+	if bucket.Get(id) == nil {
+		return fmt.Errorf("light %s not found", id)
+	}
+	return bucket.Delete(id)
+}
+
+func (l lightTx) Replace(lights map[string]*LightInfo) error {
+	if err := checkNames(lights); err != nil {
+		return err
+	}
+	last, err := readLastLightId(l.tx)
+	if err != nil {
+		return err
+	}
+	if err = writeLastLightId(l.tx, lastLightId(last, lights)); err != nil {
+		return err
+	}
+	if err = clearBucket(l.tx, "lights"); err != nil {
+		return err
+	}
+	for id, light := range lights {
+		if err = writeLight(l.tx, id, light); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLight(tx Tx, id string, light *LightInfo) error {
+	bucket := tx.Bucket("lights")
+	if bucket == nil {
+		return fmt.Errorf("bucket does not exist")
+	}
+	data, err := json.Marshal(light)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(id, data)
+}
@@ -0,0 +1,208 @@
+package hueapi
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	h, db := openTestDB(t)
+	require.NoError(t, h.SetupBolt())
+	return map[string]Store{
+		"bolt":   NewBoltStore(db),
+		"memory": NewMemoryStore(),
+	}
+}
+
+func TestStore(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			read := func() (values []string) {
+				assert.NoError(t, store.View(func(tx Tx) error {
+					return tx.Bucket("config").ForEach(func(key string, value []byte) error {
+						values = append(values, key+"="+string(value))
+						return nil
+					})
+				}))
+				return values
+			}
+
+			assert.NoError(t, store.Update(func(tx Tx) error {
+				bucket := tx.Bucket("config")
+				if err := bucket.Put("b", []byte("2")); err != nil {
+					return err
+				}
+				// changes of the same transaction are visible
+				assert.Equal(t, "2", string(bucket.Get("b")))
+				return bucket.Put("a", []byte("1"))
+			}))
+			assert.Equal(t, []string{"a=1", "b=2"}, read())
+
+			// an error discards all changes of the transaction
+			failed := errors.New("failed")
+			err := store.Update(func(tx Tx) error {
+				if err := tx.Bucket("config").Delete("a"); err != nil {
+					return err
+				}
+				if err := tx.Bucket("groups").Put("1", []byte("{}")); err != nil {
+					return err
+				}
+				return failed
+			})
+			assert.ErrorIs(t, err, failed)
+			assert.Equal(t, []string{"a=1", "b=2"}, read())
+			assert.NoError(t, store.View(func(tx Tx) error {
+				assert.Nil(t, tx.Bucket("groups").Get("1"))
+				return nil
+			}))
+
+			assert.Error(t, store.View(func(tx Tx) error {
+				return tx.Bucket("config").Put("c", []byte("3"))
+			}))
+			assert.NoError(t, store.Update(func(tx Tx) error {
+				return tx.Bucket("config").Delete("a")
+			}))
+			assert.Equal(t, []string{"b=2"}, read())
+		})
+	}
+}
+
+func TestLightTx(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Update(func(tx Tx) error {
+				lights := lightTx{tx}
+				id, err := lights.Insert(&LightInfo{Name: "Lamp"})
+				assert.NoError(t, err)
+				assert.Equal(t, "1", id)
+				_, err = lights.Insert(&LightInfo{Name: "Lamp"})
+				assert.ErrorContains(t, err, "already exists")
+				id, err = lights.Insert(&LightInfo{Name: "Desk", Type: TypeDimmable})
+				assert.NoError(t, err)
+				assert.Equal(t, "2", id)
+
+				light, err := lights.Light("2")
+				assert.NoError(t, err)
+				assert.Equal(t, "LWB010", light.ModelID)
+				_, err = lights.Light("9")
+				assert.ErrorContains(t, err, "not found")
+
+				// returned lights are copies
+				light.Name = "Changed"
+				light, err = lights.Light("2")
+				assert.NoError(t, err)
+				assert.Equal(t, "Desk", light.Name)
+
+				assert.ErrorContains(t, lights.Rename("2", "Lamp"), "already exists")
+				assert.NoError(t, lights.Rename("2", "Reading"))
+				assert.ErrorContains(t, lights.Rename("9", "Nowhere"), "not found")
+
+				bri := uint8(10)
+				modified, err := lights.Modify([]string{"1", "2"}, func(id string, light *LightInfo) error {
+					light.ApplyStateChange(id, &StateChange{Bri: &bri})
+					return nil
+				})
+				assert.NoError(t, err)
+				assert.Len(t, modified, 2)
+
+				// a failing modification leaves all lights unchanged
+				failed := errors.New("failed")
+				_, err = lights.Modify([]string{"1", "2"}, func(id string, light *LightInfo) error {
+					light.Name = "Broken"
+					if id == "2" {
+						return failed
+					}
+					return nil
+				})
+				assert.ErrorIs(t, err, failed)
+				_, err = lights.Modify([]string{"1", "9"}, func(id string, light *LightInfo) error { return nil })
+				assert.ErrorContains(t, err, "not found")
+
+				all, err := lights.Lights()
+				assert.NoError(t, err)
+				assert.Len(t, all, 2)
+				assert.Equal(t, "Lamp", all["1"].Name)
+				assert.Equal(t, "Reading", all["2"].Name)
+				assert.Equal(t, uint8(10), all["1"].State.Bri)
+				assert.Equal(t, uint8(10), all["2"].State.Bri)
+
+				assert.NoError(t, lights.Delete("1"))
+				assert.ErrorContains(t, lights.Delete("1"), "not found")
+				// ids of deleted lights are not reused
+				id, err = lights.Insert(&LightInfo{Name: "Porch"})
+				assert.NoError(t, err)
+				assert.Equal(t, "3", id)
+
+				assert.ErrorContains(t, lights.Replace(map[string]*LightInfo{"3": {Name: "A"}, "5": {Name: "A"}}), "already exists")
+				assert.NoError(t, lights.Replace(map[string]*LightInfo{"3": {Name: "A"}, "5": {Name: "B"}}))
+				all, err = lights.Lights()
+				assert.NoError(t, err)
+				assert.Len(t, all, 2)
+				assert.Equal(t, "B", all["5"].Name)
+				id, err = lights.Insert(&LightInfo{Name: "C"})
+				assert.NoError(t, err)
+				assert.Equal(t, "6", id)
+
+				// replacing with lower ids keeps the counter
+				assert.NoError(t, lights.Replace(map[string]*LightInfo{"1": {Name: "A"}}))
+				id, err = lights.Insert(&LightInfo{Name: "B"})
+				assert.NoError(t, err)
+				assert.Equal(t, "7", id)
+				return nil
+			}))
+		})
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	h := setupTestDB(t)
+	_, lightId, err := h.PutLight(&LightInfo{Name: "Lamp"})
+	assert.NoError(t, err)
+	initial, err := h.GetLight(lightId)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := h.ModifyLight(lightId, func(light *LightInfo) error {
+					light.State.Hue++
+					return nil
+				})
+				assert.NoError(t, err)
+				_, err = h.GetLights()
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	light, err := h.GetLight(lightId)
+	assert.NoError(t, err)
+	assert.Equal(t, initial.State.Hue+200, light.State.Hue)
+}
+
+func TestHueApiBoltStore(t *testing.T) {
+	h, db := openTestDB(t)
+	require.NoError(t, h.SetupBolt())
+	t.Cleanup(h.Shutdown)
+	h.setupEngine()
+	user := testUser(t, h)
+	createLights(t, h, "Kitchen", "Hall")
+
+	recorder := request(h, "PUT", "/api/"+user+"/groups/0/action", `{"bri":20}`)
+	assert.JSONEq(t, `[{"success":{"/groups/0/action/bri":20}}]`, recorder.Body.String())
+
+	// the changes are in the database
+	lights, err := (&HueApi{store: NewBoltStore(db)}).GetLights()
+	assert.NoError(t, err)
+	assert.Len(t, lights, 2)
+	assert.Equal(t, uint8(20), lights["1"].State.Bri)
+	assert.Equal(t, uint8(20), lights["2"].State.Bri)
+}
@@ -0,0 +1,154 @@
+package hueapi
+
+import (
+	"time"
+)
+
+// transitionTick is the resolution of transitiontime, which is given in multiples of 100ms.
+const transitionTick = 100 * time.Millisecond
+
+// transition interpolates the state of a light between two states over a duration.
+type transition struct {
+	from     LightState
+	to       LightState
+	start    time.Time
+	duration time.Duration
+	stop     chan struct{}
+}
+
+func lerp[T uint8 | uint16](from, to T, progress float64) T {
+	return T(float64(from) + (float64(to)-float64(from))*progress + 0.5)
+}
+
+// lerpHue interpolates the hue along the shorter way around the color wheel.
+func lerpHue(from, to uint16, progress float64) uint16 {
+	diff := int(to) - int(from)
+	if diff > 32768 {
+		diff -= 65536
+	} else if diff < -32768 {
+		diff += 65536
+	}
+	return uint16((int(from) + int(float64(diff)*progress+0.5) + 65536) % 65536)
+}
+
+// at returns the interpolated state at time now.
+func (t *transition) at(now time.Time) LightState {
+	progress := float64(now.Sub(t.start)) / float64(t.duration)
+	if progress >= 1 {
+		return t.to
+	}
+	if progress < 0 {
+		progress = 0
+	}
+	state := t.to
+	// turning off fades out with the light still on
+	state.On = t.from.On || t.to.On
+	state.Bri = lerp(t.from.Bri, t.to.Bri, progress)
+	state.Sat = lerp(t.from.Sat, t.to.Sat, progress)
+	state.Ct = lerp(t.from.Ct, t.to.Ct, progress)
+	state.Hue = lerpHue(t.from.Hue, t.to.Hue, progress)
+	if len(t.from.XY) == 2 && len(t.to.XY) == 2 {
+		state.XY = []float64{
+			t.from.XY[0] + (t.to.XY[0]-t.from.XY[0])*progress,
+			t.from.XY[1] + (t.to.XY[1]-t.from.XY[1])*progress,
+		}
+	}
+	return state
+}
+
+func newTransition(from, to LightState, duration time.Duration) *transition {
+	if !from.On {
+		from.Bri = 0
+	}
+	if !to.On {
+		// fade out before switching off
+		to.Bri = 0
+	}
+	return &transition{from: from, to: to, start: time.Now(), duration: duration, stop: make(chan struct{})}
+}
+
+// startTransition starts simulating the transition of a change with a transitiontime and marks e
+// as its target, any running transition of the light is cancelled.
+func (h *HueApi) startTransition(e *LightEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from := e.Previous
+	if running, ok := h.transitions[e.ID]; ok {
+		from = running.at(time.Now())
+		close(running.stop)
+		delete(h.transitions, e.ID)
+	}
+	if h.shutdown || e.Change == nil || e.Change.TransitionTime == nil || *e.Change.TransitionTime == 0 {
+		return
+	}
+
+	t := newTransition(from, e.State, time.Duration(*e.Change.TransitionTime)*transitionTick)
+	if h.transitions == nil {
+		h.transitions = make(map[string]*transition)
+	}
+	h.transitions[e.ID] = t
+	e.Target = true
+	h.running.Add(1)
+	go h.runTransition(e, t)
+}
+
+func (h *HueApi) runTransition(e *LightEvent, t *transition) {
+	defer h.running.Done()
+	ticker := time.NewTicker(transitionTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-ticker.C:
+			h.mu.Lock()
+			active := h.transitions[e.ID] == t
+			done := active && now.Sub(t.start) >= t.duration
+			if done {
+				delete(h.transitions, e.ID)
+			}
+			h.mu.Unlock()
+			if !active {
+				return
+			}
+			light := *e.Light
+			light.State = t.at(now)
+			if done {
+				// the stream ends on the stored state, a fade out only interpolates towards bri 0
+				light.State = e.State
+			}
+			h.notify(&LightEvent{
+				ID: e.ID, Light: &light, State: light.State, Previous: e.Previous, Change: e.Change, Transition: true,
+			})
+			if done {
+				return
+			}
+		}
+	}
+}
+
+// cancelTransition stops a running transition of the light.
+func (h *HueApi) cancelTransition(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if running, ok := h.transitions[id]; ok {
+		close(running.stop)
+		delete(h.transitions, id)
+	}
+}
+
+// currentState returns the interpolated state of a light with a running transition or colorloop,
+// or state otherwise.
+func (h *HueApi) currentState(id string, state LightState) LightState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if running, ok := h.transitions[id]; ok {
+		state = running.at(now)
+	}
+	if loop, ok := h.colorloops[id]; ok {
+		state = loop.at(now, state)
+	}
+	return state
+}
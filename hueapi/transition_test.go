@@ -0,0 +1,109 @@
+package hueapi
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionAt(t *testing.T) {
+	from := LightState{On: true, Bri: 100, Hue: 65000, Ct: 200, XY: []float64{0.1, 0.1}}
+	to := LightState{On: true, Bri: 200, Hue: 1000, Ct: 400, XY: []float64{0.3, 0.5}}
+	tr := newTransition(from, to, time.Second)
+
+	half := tr.at(tr.start.Add(500 * time.Millisecond))
+	assert.Equal(t, uint8(150), half.Bri)
+	assert.Equal(t, uint16(300), half.Ct)
+	// hue wraps around the shorter way
+	assert.Equal(t, uint16(232), half.Hue)
+	assert.InDeltaSlice(t, []float64{0.2, 0.3}, half.XY, 0.0001)
+	assert.Equal(t, to, tr.at(tr.start.Add(time.Second)))
+
+	// fading out keeps the light on until the end
+	off := newTransition(from, LightState{Bri: 100}, time.Second)
+	state := off.at(off.start.Add(500 * time.Millisecond))
+	assert.True(t, state.On)
+	assert.Equal(t, uint8(50), state.Bri)
+}
+
+func TestLightTransition(t *testing.T) {
+	h := setupTestApi(t)
+	user := testUser(t, h)
+	createLights(t, h, "Lamp")
+
+	var mu sync.Mutex
+	var events []*LightEvent
+	h.AddLightCallback(func(e *LightEvent) {
+		mu.Lock()
+		events = append(events, e)
+		mu.Unlock()
+	})
+	// waitLast waits for the transition to stream the stored state and returns all events
+	waitLast := func(stored LightState) []*LightEvent {
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			last := events[len(events)-1]
+			return last.Transition && last.State.On == stored.On && last.State.Bri == stored.Bri
+		}, 3*time.Second, 50*time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		result := events
+		events = nil
+		return result
+	}
+
+	recorder := request(h, "PUT", "/api/"+user+"/lights/1/state", `{"bri":54,"transitiontime":5}`)
+	assert.JSONEq(t, `[{"success":{"/lights/1/state/bri":54}},{"success":{"/lights/1/state/transitiontime":5}}]`,
+		recorder.Body.String())
+
+	// the target is persisted right away while GET reports the interpolated state
+	light, err := h.GetLight("1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(54), light.State.Bri)
+
+	time.Sleep(250 * time.Millisecond)
+	current := h.currentState("1", light.State)
+	assert.Greater(t, current.Bri, uint8(54))
+	assert.Less(t, current.Bri, uint8(254))
+
+	// the target event comes first and is skipped by consumers of the intermediate states, which
+	// fade from the previous state and end on the target
+	sequence := waitLast(light.State)
+	assert.Equal(t, uint8(54), h.currentState("1", light.State).Bri)
+	require.Greater(t, len(sequence), 2)
+	target := sequence[0]
+	assert.True(t, target.Target)
+	assert.False(t, target.Transition)
+	assert.Equal(t, uint8(54), target.State.Bri)
+	assert.True(t, target.Relevant(false))
+	assert.False(t, target.Relevant(true))
+	previous := target.Previous.Bri
+	for _, e := range sequence[1:] {
+		assert.True(t, e.Transition)
+		assert.False(t, e.Target)
+		assert.False(t, e.Relevant(false))
+		assert.True(t, e.Relevant(true))
+		assert.LessOrEqual(t, e.State.Bri, previous)
+		previous = e.State.Bri
+	}
+	assert.Equal(t, light.State, sequence[len(sequence)-1].State)
+
+	// turning off fades out but the stream ends on the stored state keeping bri
+	request(h, "PUT", "/api/"+user+"/lights/1/state", `{"on":false,"transitiontime":3}`)
+	light, err = h.GetLight("1")
+	assert.NoError(t, err)
+	assert.False(t, light.State.On)
+	sequence = waitLast(light.State)
+	require.Greater(t, len(sequence), 2)
+	assert.True(t, sequence[0].Target)
+	for _, e := range sequence[1 : len(sequence)-1] {
+		assert.True(t, e.State.On)
+		assert.Less(t, e.State.Bri, uint8(54))
+	}
+	assert.Equal(t, light.State, sequence[len(sequence)-1].State)
+	assert.Equal(t, uint8(54), sequence[len(sequence)-1].State.Bri)
+}
@@ -0,0 +1,137 @@
+package hueapi
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	linkButtonWindow = 30 * time.Second
+	hueTimeFormat    = "2006-01-02T15:04:05"
+	lastUseInterval  = time.Minute
+)
+
+// WhitelistEntry is a user allowed to access the api, see config.whitelist in the Hue api.
+type WhitelistEntry struct {
+	Name        string `json:"name"`
+	CreateDate  string `json:"create date"`
+	LastUseDate string `json:"last use date"`
+}
+
+// PressLinkButton opens the pairing window during which new users can be created.
+func (h *HueApi) PressLinkButton() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.linkButtonUntil = time.Now().Add(linkButtonWindow)
+	return h.linkButtonUntil
+}
+
+func (h *HueApi) LinkButtonPressed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Now().Before(h.linkButtonUntil)
+}
+
+// SetAdminToken allows access to the admin endpoints with a bearer token in addition to loopback clients.
+func (h *HueApi) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+func newUsername() (string, error) {
+	data := make([]byte, 20)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// authorized aborts requests to /api/:user routes when the user is not in the whitelist.
+func (h *HueApi) authorized(c *gin.Context) {
+	username := c.Param("user")
+	entry, err := h.GetUser(username)
+	if err != nil {
+		abortWithError(c, apiAddress(c.Request.URL.Path), err)
+		return
+	}
+	if entry == nil {
+		abortWithErrors(c, NewError(ErrorUnauthorizedUser, apiAddress(c.Request.URL.Path)))
+		return
+	}
+	if lastUse, _ := time.Parse(hueTimeFormat, entry.LastUseDate); time.Since(lastUse) > lastUseInterval {
+		if err = h.TouchUser(username); err != nil {
+			h.logger.Errorf("user %s last use update error: %s", username, err)
+		}
+	}
+	c.Next()
+}
+
+// adminOnly restricts admin endpoints to loopback clients or requests bearing the admin token.
+func (h *HueApi) adminOnly(c *gin.Context) {
+	if ip := net.ParseIP(c.RemoteIP()); ip != nil && ip.IsLoopback() {
+		c.Next()
+		return
+	}
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if ok && h.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) == 1 {
+		c.Next()
+		return
+	}
+	c.AbortWithStatus(http.StatusForbidden)
+}
+
+func (h *HueApi) Authenticate(c *gin.Context) {
+	authRequest := &AuthRequest{}
+	if err := c.ShouldBindJSON(authRequest); err != nil {
+		abortWithErrors(c, bindError("/", err))
+		return
+	}
+	if authRequest.DeviceType == "" {
+		abortWithErrors(c, NewError(ErrorMissingParameters, "/"))
+		return
+	}
+	if !h.LinkButtonPressed() {
+		abortWithErrors(c, NewError(ErrorLinkButtonNotPressed, ""))
+		return
+	}
+	username, err := h.AddUser(authRequest.DeviceType)
+	if err != nil {
+		abortWithError(c, "/", err)
+		return
+	}
+	h.logger.Infof("user %s created for %s", username, authRequest.DeviceType)
+	response := make([]AuthResponse, 1)
+	response[0].Success.Username = username
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *HueApi) AdminLinkButton(c *gin.Context) {
+	until := h.PressLinkButton()
+	c.JSON(http.StatusOK, gin.H{"linkbutton": true, "until": until.Format(time.RFC3339)})
+}
+
+func (h *HueApi) AdminUsers(c *gin.Context) {
+	users, err := h.GetUsers()
+	if err != nil {
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func (h *HueApi) AdminDeleteUser(c *gin.Context) {
+	if err := h.DeleteUser(c.Param("username")); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	c.Status(http.StatusOK)
+}
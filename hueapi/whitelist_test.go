@@ -0,0 +1,58 @@
+package hueapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-json"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairing(t *testing.T) {
+	h := setupTestApi(t)
+
+	errs := hueErrors(t, request(h, "POST", "/api", `{"devicetype":"echo#kitchen"}`))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorLinkButtonNotPressed, errs[0].Type)
+	}
+
+	// admin endpoints are restricted to loopback clients
+	assert.Equal(t, http.StatusForbidden, request(h, "POST", "/admin/linkbutton", "").Code)
+	assert.Equal(t, http.StatusOK, adminRequest(h, "POST", "/admin/linkbutton", "").Code)
+	assert.True(t, h.LinkButtonPressed())
+
+	recorder := request(h, "POST", "/api", `{"devicetype":"echo#kitchen"}`)
+	var response []AuthResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	username := response[0].Success.Username
+	assert.Len(t, username, 40)
+
+	entry, err := h.GetUser(username)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo#kitchen", entry.Name)
+
+	assert.Equal(t, "{}", request(h, "GET", "/api/"+username+"/lights", "").Body.String())
+
+	assert.Equal(t, http.StatusOK, adminRequest(h, "DELETE", "/admin/users/"+username, "").Code)
+	errs = hueErrors(t, request(h, "GET", "/api/"+username+"/lights", ""))
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, ErrorUnauthorizedUser, errs[0].Type)
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	h := setupTestApi(t)
+
+	req := httptest.NewRequest("POST", "/admin/linkbutton", strings.NewReader(""))
+	req.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	h.Handler().ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+
+	h.SetAdminToken("secret")
+	recorder = httptest.NewRecorder()
+	h.Handler().ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
@@ -0,0 +1,249 @@
+package mqtt
+
+import (
+	"fmt"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/goccy/go-json"
+	"github.com/mlctrez/ehugo/hueapi"
+	"github.com/mlctrez/servicego"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultStateTopic   = "ehugo/lights/{id}/state"
+	DefaultCommandTopic = "ehugo/lights/{id}/set"
+	DefaultClientID     = "ehugo"
+	idPlaceholder       = "{id}"
+	timeout             = 10 * time.Second
+)
+
+// Bridge publishes light state changes to MQTT and applies state changes
+// received on the command topic to the lights of a HueApi.
+type Bridge struct {
+	logger       servicego.Logger
+	hueApi       *hueapi.HueApi
+	broker       string
+	clientID     string
+	username     string
+	password     string
+	stateTopic   string
+	commandTopic string
+	transitions  bool
+	client       paho.Client
+
+	mu      sync.Mutex
+	pending map[string][]byte
+	signal  chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func New(logger servicego.Logger, hueApi *hueapi.HueApi, opts ...Option) *Bridge {
+	b := &Bridge{
+		logger:       logger,
+		hueApi:       hueApi,
+		clientID:     DefaultClientID,
+		stateTopic:   DefaultStateTopic,
+		commandTopic: DefaultCommandTopic,
+		pending:      make(map[string][]byte),
+		signal:       make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Connect connects to the broker, subscribes to the command topic and
+// publishes the current state of every light.
+func (b *Bridge) Connect() error {
+	if !strings.Contains(b.stateTopic, idPlaceholder) || !strings.Contains(b.commandTopic, idPlaceholder) {
+		return fmt.Errorf("mqtt topics must contain %s", idPlaceholder)
+	}
+
+	options := paho.NewClientOptions().
+		AddBroker(b.broker).
+		SetClientID(b.clientID).
+		SetUsername(b.username).
+		SetPassword(b.password).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			b.logger.Errorf("mqtt connection lost: %s", err)
+		})
+
+	b.client = paho.NewClient(options)
+	if err := wait(b.client.Connect()); err != nil {
+		return fmt.Errorf("mqtt connect %s: %w", b.broker, err)
+	}
+	// states queued by onConnect are sent once the publisher runs
+	b.done = make(chan struct{})
+	b.wg.Add(1)
+	go b.publisher()
+	return nil
+}
+
+func (b *Bridge) Shutdown() {
+	if b.done != nil {
+		close(b.done)
+		b.wg.Wait()
+		b.done = nil
+	}
+	if b.client != nil {
+		b.client.Disconnect(250)
+	}
+}
+
+// LightCallback publishes the new state of a light, register it with HueApi.AddLightCallback.
+func (b *Bridge) LightCallback(e *hueapi.LightEvent) {
+	if b.client == nil || !b.client.IsConnectionOpen() || !e.Relevant(b.transitions) {
+		return
+	}
+	light := *e.Light
+	light.State = e.State
+	b.publish(e.ID, &light)
+}
+
+// onConnect runs on every (re)connect since subscriptions are not kept by a clean session.
+func (b *Bridge) onConnect(client paho.Client) {
+	topic := strings.Replace(b.commandTopic, idPlaceholder, "+", 1)
+	if err := wait(client.Subscribe(topic, 1, b.onCommand)); err != nil {
+		b.logger.Errorf("mqtt subscribe %s error: %s", topic, err)
+	}
+
+	lights, err := b.hueApi.GetLights()
+	if err != nil {
+		b.logger.Errorf("mqtt get lights error: %s", err)
+		return
+	}
+	for id, light := range lights {
+		b.publish(id, light)
+	}
+}
+
+func (b *Bridge) onCommand(_ paho.Client, message paho.Message) {
+	id, ok := b.lightId(message.Topic())
+	if !ok {
+		return
+	}
+	change := &hueapi.StateChange{}
+	if err := json.Unmarshal(message.Payload(), change); err != nil {
+		b.logger.Errorf("mqtt command %s invalid payload: %s", message.Topic(), err)
+		return
+	}
+	if _, err := b.hueApi.ChangeLightState(id, change); err != nil {
+		b.logger.Errorf("mqtt command %s error: %s", message.Topic(), err)
+	}
+}
+
+// publish queues the state of a light as the API reports it for the publisher without waiting for
+// the broker, a state still queued is replaced so a slow broker receives the latest state of every
+// light.
+func (b *Bridge) publish(id string, light *hueapi.LightInfo) {
+	payload, err := light.StateJSON()
+	if err != nil {
+		b.logger.Errorf("mqtt publish light %s error: %s", id, err)
+		return
+	}
+	b.mu.Lock()
+	b.pending[strings.Replace(b.stateTopic, idPlaceholder, id, 1)] = payload
+	b.mu.Unlock()
+	select {
+	case b.signal <- struct{}{}:
+	default:
+	}
+}
+
+// publisher sends the queued states until Shutdown, failures are logged.
+func (b *Bridge) publisher() {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.signal:
+		}
+		b.mu.Lock()
+		pending := b.pending
+		b.pending = make(map[string][]byte)
+		b.mu.Unlock()
+		for topic, payload := range pending {
+			token := b.client.Publish(topic, 1, true, payload)
+			select {
+			case <-b.done:
+				return
+			case <-token.Done():
+				if err := token.Error(); err != nil {
+					b.logger.Errorf("mqtt publish %s error: %s", topic, err)
+				}
+			case <-time.After(timeout):
+				b.logger.Errorf("mqtt publish %s error: timeout after %s", topic, timeout)
+			}
+		}
+	}
+}
+
+// lightId extracts the light id from a topic matching the command topic.
+func (b *Bridge) lightId(topic string) (string, bool) {
+	prefix, suffix, _ := strings.Cut(b.commandTopic, idPlaceholder)
+	if !strings.HasPrefix(topic, prefix) || !strings.HasSuffix(topic, suffix) {
+		return "", false
+	}
+	id := strings.TrimSuffix(strings.TrimPrefix(topic, prefix), suffix)
+	if id == "" || strings.Contains(id, "/") {
+		return "", false
+	}
+	return id, true
+}
+
+func wait(token paho.Token) error {
+	if !token.WaitTimeout(timeout) {
+		return fmt.Errorf("timeout after %s", timeout)
+	}
+	return token.Error()
+}
+
+type Option func(*Bridge)
+
+func WithBroker(broker string) Option {
+	return func(b *Bridge) {
+		b.broker = broker
+	}
+}
+
+func WithClientID(clientID string) Option {
+	return func(b *Bridge) {
+		b.clientID = clientID
+	}
+}
+
+func WithCredentials(username, password string) Option {
+	return func(b *Bridge) {
+		b.username = username
+		b.password = password
+	}
+}
+
+// WithStateTopic sets the topic state changes are published to, {id} is replaced with the light id.
+func WithStateTopic(topic string) Option {
+	return func(b *Bridge) {
+		b.stateTopic = topic
+	}
+}
+
+// WithTransitions publishes the intermediate states of transitions and effects in addition to the
+// final state.
+func WithTransitions(transitions bool) Option {
+	return func(b *Bridge) {
+		b.transitions = transitions
+	}
+}
+
+// WithCommandTopic sets the topic state changes are received on, {id} is replaced with the light id.
+func WithCommandTopic(topic string) Option {
+	return func(b *Bridge) {
+		b.commandTopic = topic
+	}
+}
@@ -0,0 +1,223 @@
+package mqtt
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/goccy/go-json"
+	"github.com/mlctrez/ehugo/hueapi"
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLogger struct{ t *testing.T }
+
+func (l *testLogger) Infof(format string, args ...interface{})  { l.t.Logf(format, args...) }
+func (l *testLogger) Errorf(format string, args ...interface{}) { l.t.Logf(format, args...) }
+
+func startBroker(t *testing.T, hooks ...server.Hook) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	broker := server.New(&server.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, broker.AddHook(new(auth.AllowHook), nil))
+	for _, hook := range hooks {
+		require.NoError(t, broker.AddHook(hook, nil))
+	}
+	require.NoError(t, broker.AddListener(listeners.NewNet("test", listener)))
+	go func() { _ = broker.Serve() }()
+	t.Cleanup(func() { _ = broker.Close() })
+
+	return "tcp://" + listener.Addr().String()
+}
+
+func setupHueApi(t *testing.T) *hueapi.HueApi {
+	h := hueapi.New(&testLogger{t}, nil, "127.0.0.1:80")
+	require.NoError(t, h.SetupBolt())
+	return h
+}
+
+func TestBridge(t *testing.T) {
+	brokerUrl := startBroker(t)
+	h := setupHueApi(t)
+	_, lightId, err := h.PutLight(&hueapi.LightInfo{Name: "Lamp"})
+	require.NoError(t, err)
+
+	bridge := New(&testLogger{t}, h, WithBroker(brokerUrl))
+	h.AddLightCallback(bridge.LightCallback)
+	require.NoError(t, bridge.Connect())
+	defer bridge.Shutdown()
+
+	states := make(chan hueapi.LightState, 10)
+	observer := paho.NewClient(paho.NewClientOptions().AddBroker(brokerUrl).SetClientID("observer"))
+	require.NoError(t, wait(observer.Connect()))
+	defer observer.Disconnect(250)
+	require.NoError(t, wait(observer.Subscribe("ehugo/lights/"+lightId+"/state", 1,
+		func(_ paho.Client, message paho.Message) {
+			state := hueapi.LightState{}
+			assert.NoError(t, json.Unmarshal(message.Payload(), &state))
+			states <- state
+		})))
+
+	next := func() hueapi.LightState {
+		select {
+		case state := <-states:
+			return state
+		case <-time.After(5 * time.Second):
+			t.Fatal("no state published")
+		}
+		return hueapi.LightState{}
+	}
+
+	// retained state published on connect
+	assert.True(t, next().On)
+
+	// command topic changes the stored light and publishes the new state
+	require.NoError(t, wait(observer.Publish("ehugo/lights/"+lightId+"/set", 1, false, `{"on":false,"bri":42}`)))
+	state := next()
+	assert.False(t, state.On)
+	assert.Equal(t, uint8(42), state.Bri)
+
+	light, err := h.GetLight(lightId)
+	require.NoError(t, err)
+	assert.False(t, light.State.On)
+	assert.Equal(t, uint8(42), light.State.Bri)
+
+	// changes made through the api are published as well
+	on := true
+	_, err = h.ChangeLightState(lightId, &hueapi.StateChange{On: &on})
+	require.NoError(t, err)
+	assert.True(t, next().On)
+}
+
+func TestBridgeLightView(t *testing.T) {
+	brokerUrl := startBroker(t)
+	h := setupHueApi(t)
+	_, plugId, err := h.PutLight(&hueapi.LightInfo{Name: "Plug", Type: hueapi.TypeOnOffPlug})
+	require.NoError(t, err)
+
+	bridge := New(&testLogger{t}, h, WithBroker(brokerUrl))
+	h.AddLightCallback(bridge.LightCallback)
+	require.NoError(t, bridge.Connect())
+	defer bridge.Shutdown()
+
+	payloads := make(chan map[string]any, 10)
+	observer := paho.NewClient(paho.NewClientOptions().AddBroker(brokerUrl).SetClientID("observer"))
+	require.NoError(t, wait(observer.Connect()))
+	defer observer.Disconnect(250)
+	require.NoError(t, wait(observer.Subscribe("ehugo/lights/"+plugId+"/state", 1,
+		func(_ paho.Client, message paho.Message) {
+			payload := map[string]any{}
+			assert.NoError(t, json.Unmarshal(message.Payload(), &payload))
+			payloads <- payload
+		})))
+
+	// only the state attributes of the light type are published
+	select {
+	case payload := <-payloads:
+		assert.Contains(t, payload, "on")
+		assert.Contains(t, payload, "reachable")
+		assert.NotContains(t, payload, "bri")
+		assert.NotContains(t, payload, "xy")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no state published")
+	}
+}
+
+func TestBridgeConnectError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	brokerUrl := "tcp://" + listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	bridge := New(&testLogger{t}, setupHueApi(t), WithBroker(brokerUrl))
+	assert.Error(t, bridge.Connect())
+	// no publisher is left running
+	assert.Nil(t, bridge.done)
+	bridge.Shutdown()
+}
+
+// slowHook delays the acknowledgement of the publishes of the bridge.
+type slowHook struct {
+	server.HookBase
+}
+
+func (h *slowHook) ID() string {
+	return "slow"
+}
+
+func (h *slowHook) Provides(b byte) bool {
+	return b == server.OnPublish
+}
+
+func (h *slowHook) OnPublish(cl *server.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.ID == DefaultClientID {
+		time.Sleep(200 * time.Millisecond)
+	}
+	return pk, nil
+}
+
+func TestBridgeSlowBroker(t *testing.T) {
+	brokerUrl := startBroker(t, new(slowHook))
+	h := setupHueApi(t)
+	_, lightId, err := h.PutLight(&hueapi.LightInfo{Name: "Lamp"})
+	require.NoError(t, err)
+
+	bridge := New(&testLogger{t}, h, WithBroker(brokerUrl))
+	h.AddLightCallback(bridge.LightCallback)
+	require.NoError(t, bridge.Connect())
+	defer bridge.Shutdown()
+
+	states := make(chan hueapi.LightState, 10)
+	observer := paho.NewClient(paho.NewClientOptions().AddBroker(brokerUrl).SetClientID("observer"))
+	require.NoError(t, wait(observer.Connect()))
+	defer observer.Disconnect(250)
+	require.NoError(t, wait(observer.Subscribe("ehugo/lights/"+lightId+"/state", 1,
+		func(_ paho.Client, message paho.Message) {
+			state := hueapi.LightState{}
+			assert.NoError(t, json.Unmarshal(message.Payload(), &state))
+			states <- state
+		})))
+
+	// state changes do not wait for the broker
+	start := time.Now()
+	for bri := uint8(1); bri <= 5; bri++ {
+		_, err = h.ChangeLightState(lightId, &hueapi.StateChange{Bri: &bri})
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), 200*time.Millisecond)
+
+	// the latest state is published eventually
+	for {
+		select {
+		case state := <-states:
+			if state.Bri == 5 {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("latest state not published")
+		}
+	}
+}
+
+func TestLightId(t *testing.T) {
+	b := New(nil, nil, WithCommandTopic("home/{id}/hue/set"))
+	for topic, expected := range map[string]string{
+		"home/7/hue/set":   "7",
+		"home/7/8/hue/set": "",
+		"home//hue/set":    "",
+		"other/7/hue/set":  "",
+	} {
+		id, ok := b.lightId(topic)
+		assert.Equal(t, expected, id, topic)
+		assert.Equal(t, expected != "", ok, topic)
+	}
+}
@@ -3,19 +3,25 @@ package service
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/kardianos/service"
 	"github.com/mlctrez/ehugo/hueapi"
+	"github.com/mlctrez/ehugo/mqtt"
 	"github.com/mlctrez/ehugo/ssdp"
 	"github.com/mlctrez/servicego"
 	"go.etcd.io/bbolt"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 )
 
 var _ servicego.Service = (*svc)(nil)
 
+var memory = flag.Bool("memory", false, "Keep all data in memory instead of database.db, nothing is persisted")
+
 type svc struct {
 	servicego.Defaults
 	addr       string
@@ -23,6 +29,7 @@ type svc struct {
 	apiServer  *http.Server
 	hueApi     *hueapi.HueApi
 	boltDb     *bbolt.DB
+	mqttBridge *mqtt.Bridge
 }
 
 func New() servicego.Service {
@@ -38,7 +45,9 @@ func (g *svc) Start(s service.Service) (err error) {
 		NoGrowSync:   false,
 		FreelistType: bbolt.FreelistArrayType,
 	}
-	if g.boltDb, err = bbolt.Open("database.db", 0600, options); err != nil {
+	if *memory {
+		g.Infof("running in memory mode, nothing is persisted")
+	} else if g.boltDb, err = bbolt.Open("database.db", 0600, options); err != nil {
 		return err
 	}
 
@@ -46,23 +55,52 @@ func (g *svc) Start(s service.Service) (err error) {
 	if g.addr == "" {
 		return fmt.Errorf("ADDRESS environment variable not set")
 	}
+	if err = checkAddress(g.addr, ssdpInterfaces()); err != nil {
+		return err
+	}
 	bridgeOne := &ssdp.BridgeInfo{
 		SerialNumber: "001788FFFE23BFC1",
 		UUID:         "2f402f80-da50-11e1-9b23-001788255acc",
 	}
 	g.hueApi = hueapi.New(g, g.boltDb, g.addr, bridgeOne)
+	g.hueApi.SetAdminToken(os.Getenv("ADMIN_TOKEN"))
+	filter, err := ssdpFilter()
+	if err != nil {
+		return err
+	}
+	g.hueApi.SetSSDPFilter(filter)
+	g.hueApi.SetSSDPVerbose(os.Getenv("SSDP_VERBOSE") == "true")
 	if err = g.hueApi.SetupBolt(); err != nil {
 		return err
 	}
 
+	if err = g.startMqtt(); err != nil {
+		return err
+	}
+
 	g.apiServer = &http.Server{Addr: g.addr, Handler: g.hueApi.Handler()}
 	go g.serveHttp()
 
-	g.ssdpServer = ssdp.New(ssdp.WithCallback(g.hueApi.SSDPCallback))
+	// SSDP_INTERFACES is a comma separated list of interfaces to listen on, replies use the address
+	// of the interface a search arrived on, so ADDRESS should listen on all of them, e.g. :80
+	ssdpOpts := []ssdp.Option{
+		ssdp.WithCallback(g.hueApi.SSDPCallback),
+		ssdp.WithBridges(bridgeOne),
+		ssdp.WithIPv6(os.Getenv("SSDP_IPV6") == "true"),
+	}
+	ssdpOpts = append(ssdpOpts, ssdp.WithInterfaces(ssdpInterfaces()...))
+	if interval := os.Getenv("SSDP_NOTIFY_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("SSDP_NOTIFY_INTERVAL: %w", err)
+		}
+		ssdpOpts = append(ssdpOpts, ssdp.WithNotifyInterval(d))
+	}
+	g.ssdpServer = ssdp.New(ssdpOpts...)
 	if err = g.ssdpServer.Listen(); err != nil {
 		return err
 	}
-	go g.ssdpServer.Read()
+	go g.ssdpServer.Read(context.Background())
 
 	return nil
 }
@@ -82,6 +120,12 @@ func (g *svc) Stop(s service.Service) error {
 	if g.ssdpServer != nil {
 		g.ssdpServer.Shutdown()
 	}
+	if g.hueApi != nil {
+		g.hueApi.Shutdown()
+	}
+	if g.mqttBridge != nil {
+		g.mqttBridge.Shutdown()
+	}
 	if g.boltDb != nil {
 		if err := g.boltDb.Close(); err != nil {
 			g.Errorf("error closing database: %v", err)
@@ -97,3 +141,73 @@ func (g *svc) serveHttp() {
 		}
 	}
 }
+
+// checkAddress requires ADDRESS to name the host devices reach the bridge on, the SSDP location is
+// built from it. Only with SSDP_INTERFACES the address of the receiving interface is used instead.
+func checkAddress(addr string, interfaces []string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("ADDRESS: %w", err)
+	}
+	if ip := net.ParseIP(host); (host == "" || ip != nil && ip.IsUnspecified()) && len(interfaces) == 0 {
+		return fmt.Errorf("ADDRESS %s needs a host unless SSDP_INTERFACES is set", addr)
+	}
+	return nil
+}
+
+func ssdpInterfaces() []string {
+	var result []string
+	for _, name := range strings.Split(os.Getenv("SSDP_INTERFACES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// ssdpFilter limits the answered SSDP searches with the comma separated lists in SSDP_ALLOW_CIDRS,
+// SSDP_DENY_CIDRS, SSDP_ALLOW_ST and SSDP_DENY_ST, e.g. SSDP_ALLOW_CIDRS=10.0.0.0/24,192.168.1.7
+// SSDP_DENY_ST replaces the default which ignores DIAL searches.
+func ssdpFilter() (*ssdp.Filter, error) {
+	filter := ssdp.DefaultFilter()
+	var err error
+	if filter.AllowCIDRs, err = ssdp.ParseCIDRs(os.Getenv("SSDP_ALLOW_CIDRS")); err != nil {
+		return nil, fmt.Errorf("SSDP_ALLOW_CIDRS: %w", err)
+	}
+	if filter.DenyCIDRs, err = ssdp.ParseCIDRs(os.Getenv("SSDP_DENY_CIDRS")); err != nil {
+		return nil, fmt.Errorf("SSDP_DENY_CIDRS: %w", err)
+	}
+	if filter.AllowST, err = ssdp.ParsePatterns(os.Getenv("SSDP_ALLOW_ST")); err != nil {
+		return nil, fmt.Errorf("SSDP_ALLOW_ST: %w", err)
+	}
+	if deny, ok := os.LookupEnv("SSDP_DENY_ST"); ok {
+		if filter.DenyST, err = ssdp.ParsePatterns(deny); err != nil {
+			return nil, fmt.Errorf("SSDP_DENY_ST: %w", err)
+		}
+	}
+	return filter, nil
+}
+
+// startMqtt connects the mqtt bridge when MQTT_BROKER is set, e.g. tcp://localhost:1883
+func (g *svc) startMqtt() error {
+	broker := os.Getenv("MQTT_BROKER")
+	if broker == "" {
+		return nil
+	}
+	opts := []mqtt.Option{
+		mqtt.WithBroker(broker),
+		mqtt.WithCredentials(os.Getenv("MQTT_USERNAME"), os.Getenv("MQTT_PASSWORD")),
+	}
+	if topic := os.Getenv("MQTT_STATE_TOPIC"); topic != "" {
+		opts = append(opts, mqtt.WithStateTopic(topic))
+	}
+	if topic := os.Getenv("MQTT_COMMAND_TOPIC"); topic != "" {
+		opts = append(opts, mqtt.WithCommandTopic(topic))
+	}
+	if os.Getenv("MQTT_TRANSITIONS") == "true" {
+		opts = append(opts, mqtt.WithTransitions(true))
+	}
+	g.mqttBridge = mqtt.New(g, g.hueApi, opts...)
+	g.hueApi.AddLightCallback(g.mqttBridge.LightCallback)
+	return g.mqttBridge.Connect()
+}
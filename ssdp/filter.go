@@ -0,0 +1,102 @@
+package ssdp
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// Filter decides which clients and search targets are answered. Deny rules take precedence
+// over allow rules and an empty allow list allows everything, so the zero Filter allows all.
+//
+// ST patterns use path.Match syntax, e.g. urn:dial-multiscreen-org:*
+type Filter struct {
+	AllowCIDRs []*net.IPNet
+	DenyCIDRs  []*net.IPNet
+	AllowST    []string
+	DenyST     []string
+}
+
+// DefaultFilter ignores searches of DIAL clients like TVs and media players, which never look for a bridge.
+func DefaultFilter() *Filter {
+	return &Filter{DenyST: []string{"urn:dial-multiscreen-org:*"}}
+}
+
+// ParseCIDRs parses a comma separated list of CIDRs, single addresses match only themselves.
+func ParseCIDRs(list string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, item := range splitList(list) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", item)
+			}
+			bits := 8 * len(ip)
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+// ParsePatterns parses a comma separated list of ST patterns.
+func ParsePatterns(list string) ([]string, error) {
+	result := splitList(list)
+	for _, pattern := range result {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return result, nil
+}
+
+func splitList(list string) []string {
+	var result []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// Allows reports whether a search for st from the client ip is answered.
+func (f *Filter) Allows(ip net.IP, st string) bool {
+	if f == nil {
+		return true
+	}
+	if containsIP(f.DenyCIDRs, ip) || matchST(f.DenyST, st) {
+		return false
+	}
+	if len(f.AllowCIDRs) > 0 && !containsIP(f.AllowCIDRs, ip) {
+		return false
+	}
+	return len(f.AllowST) == 0 || matchST(f.AllowST, st)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchST(patterns []string, st string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, st); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package ssdp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	networks, err := ParseCIDRs(" 10.0.0.0/24, 192.168.1.7 ,fd00::/8,")
+	require.NoError(t, err)
+	require.Len(t, networks, 3)
+	assert.Equal(t, "192.168.1.7/32", networks[1].String())
+
+	_, err = ParseCIDRs("10.0.0.0/33")
+	assert.Error(t, err)
+	_, err = ParseCIDRs("echo")
+	assert.Error(t, err)
+
+	networks, err = ParseCIDRs("")
+	assert.NoError(t, err)
+	assert.Empty(t, networks)
+}
+
+func TestParsePatterns(t *testing.T) {
+	patterns, err := ParsePatterns("upnp:rootdevice, urn:schemas-upnp-org:device:*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"upnp:rootdevice", "urn:schemas-upnp-org:device:*"}, patterns)
+
+	_, err = ParsePatterns("urn:[")
+	assert.Error(t, err)
+}
+
+func TestFilterAllows(t *testing.T) {
+	mustCIDRs := func(list string) []*net.IPNet {
+		networks, err := ParseCIDRs(list)
+		require.NoError(t, err)
+		return networks
+	}
+	const basic = "urn:schemas-upnp-org:device:basic:1"
+	const dial = "urn:dial-multiscreen-org:service:dial:1"
+
+	tests := []struct {
+		name   string
+		filter *Filter
+		ip     string
+		st     string
+		allows bool
+	}{
+		{"nil filter", nil, "10.0.0.45", dial, true},
+		{"zero filter", &Filter{}, "192.168.1.20", basic, true},
+		{"default filter", DefaultFilter(), "192.168.1.20", basic, true},
+		{"default filter dial", DefaultFilter(), "192.168.1.20", dial, false},
+		{"allowed cidr", &Filter{AllowCIDRs: mustCIDRs("10.0.0.0/24")}, "10.0.0.45", basic, true},
+		{"not allowed cidr", &Filter{AllowCIDRs: mustCIDRs("10.0.0.0/24")}, "10.0.1.45", basic, false},
+		{"denied address", &Filter{AllowCIDRs: mustCIDRs("10.0.0.0/24"), DenyCIDRs: mustCIDRs("10.0.0.9")}, "10.0.0.9", basic, false},
+		{"ipv6 allowed", &Filter{AllowCIDRs: mustCIDRs("fe80::/10")}, "fe80::1", basic, true},
+		{"ipv4 not in ipv6", &Filter{AllowCIDRs: mustCIDRs("fe80::/10")}, "10.0.0.45", basic, false},
+		{"allowed st", &Filter{AllowST: []string{"upnp:rootdevice", "urn:schemas-upnp-org:device:*"}}, "10.0.0.45", basic, true},
+		{"not allowed st", &Filter{AllowST: []string{"upnp:rootdevice"}}, "10.0.0.45", basic, false},
+		{"denied st wins", &Filter{AllowST: []string{"*"}, DenyST: []string{"ssdp:all"}}, "10.0.0.45", "ssdp:all", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.allows, tt.filter.Allows(net.ParseIP(tt.ip), tt.st))
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package ssdp
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"time"
+)
+
+const (
+	DefaultNotifyInterval = 50 * time.Second
+	serverHeader          = "FreeRTOS/6.0.5, UPnP/1.0, IpBridge/1.16.0"
+	deviceType            = "urn:schemas-upnp-org:device:basic:1"
+)
+
+// target is a notification or search target provided by a bridge along with its unique service name.
+type target struct {
+	nt  string
+	usn string
+}
+
+// targets returns the root device, uuid and device type targets of the bridge.
+func (b *BridgeInfo) targets() []target {
+	uuid := "uuid:" + b.UUID
+	return []target{
+		{"upnp:rootdevice", uuid + "::upnp:rootdevice"},
+		{uuid, uuid},
+		{deviceType, uuid + "::" + deviceType},
+	}
+}
+
+// maxAge is the CACHE-CONTROL max-age for the notify interval, it spans two intervals
+// so that a single lost announcement does not expire the bridge.
+func maxAge(interval time.Duration) int {
+	return int(math.Ceil((2 * interval).Seconds()))
+}
+
+func (s *SSDP) alive(b *BridgeInfo, t target, l *listener, local net.IP) string {
+	return fmt.Sprintf("NOTIFY * HTTP/1.1\r\n"+
+		"HOST: %s\r\n"+
+		"CACHE-CONTROL: max-age=%d\r\n"+
+		"LOCATION: %s\r\n"+
+		"SERVER: %s\r\n"+
+		"NTS: ssdp:alive\r\n"+
+		"hue-bridgeid: %s\r\n"+
+		"NT: %s\r\n"+
+		"USN: %s\r\n"+
+		"\r\n",
+		l.group.String(), maxAge(s.notifyInterval), b.location(local), serverHeader, b.SerialNumber, t.nt, t.usn,
+	)
+}
+
+func (s *SSDP) byebye(t target, l *listener) string {
+	return fmt.Sprintf("NOTIFY * HTTP/1.1\r\n"+
+		"HOST: %s\r\n"+
+		"NTS: ssdp:byebye\r\n"+
+		"NT: %s\r\n"+
+		"USN: %s\r\n"+
+		"\r\n",
+		l.group.String(), t.nt, t.usn,
+	)
+}
+
+// notify multicasts the alive or byebye messages of all targets of all bridges on every joined interface.
+func (s *SSDP) notify(alive bool) {
+	for _, l := range s.listeners {
+		interfaces := l.interfaces
+		if len(interfaces) == 0 {
+			interfaces = []*net.Interface{nil}
+		}
+		for _, ifi := range interfaces {
+			var local net.IP
+			if ifi != nil {
+				local = interfaceIP(ifi, l.ipv4 != nil, nil)
+			}
+			for _, bridge := range s.bridges {
+				for _, t := range bridge.targets() {
+					message := s.byebye(t, l)
+					if alive {
+						message = s.alive(bridge, t, l, local)
+					}
+					_ = l.writeTo([]byte(message), ifi)
+				}
+			}
+		}
+	}
+}
+
+// startAdvertiser announces the bridges now and then every notify interval until Shutdown.
+func (s *SSDP) startAdvertiser() {
+	if len(s.bridges) == 0 || s.notifyInterval <= 0 {
+		return
+	}
+	s.done = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.notifyInterval)
+		defer ticker.Stop()
+		for {
+			s.notify(true)
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopAdvertiser stops the announcements and tells devices the bridges are leaving.
+func (s *SSDP) stopAdvertiser() {
+	if s.done == nil {
+		return
+	}
+	close(s.done)
+	s.wg.Wait()
+	s.done = nil
+	s.notify(false)
+}
@@ -0,0 +1,96 @@
+package ssdp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localSSDP returns an SSDP sending its multicast messages to the returned receiver.
+func localSSDP(t *testing.T, opts ...Option) (*SSDP, *net.UDPConn) {
+	receiver, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = receiver.Close() })
+
+	s := New(opts...)
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	s.listeners = append(s.listeners, newListener(conn, receiver.LocalAddr().(*net.UDPAddr)))
+	return s, receiver
+}
+
+func receive(t *testing.T, conn *net.UDPConn, count int) []*Packet {
+	var result []*Packet
+	buffer := make([]byte, maxBufferSize)
+	for i := 0; i < count; i++ {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		n, client, err := conn.ReadFromUDP(buffer)
+		require.NoError(t, err)
+		p := &Packet{Client: client, Data: append([]byte(nil), buffer[:n]...)}
+		require.NoError(t, p.Parse())
+		result = append(result, p)
+	}
+	return result
+}
+
+func TestAdvertiser(t *testing.T) {
+	bridge := &BridgeInfo{
+		Location:     "http://10.0.0.2:80/bridge/001788FFFE23BFC1/device.xml",
+		SerialNumber: "001788FFFE23BFC1",
+		UUID:         "2f402f80-da50-11e1-9b23-001788255acc",
+	}
+	s, receiver := localSSDP(t, WithBridges(bridge), WithNotifyInterval(100*time.Millisecond))
+	s.startAdvertiser()
+
+	// the first announcement is sent right away, the next one after the interval
+	packets := receive(t, receiver, 6)
+	var usns []string
+	for _, p := range packets[:3] {
+		assert.Equal(t, "NOTIFY", p.Method)
+		assert.Equal(t, "ssdp:alive", p.MIMEHeader.Get("NTS"))
+		assert.Equal(t, "max-age=1", p.MIMEHeader.Get("Cache-Control"))
+		assert.Equal(t, bridge.Location, p.MIMEHeader.Get("Location"))
+		assert.Equal(t, bridge.SerialNumber, p.MIMEHeader.Get("hue-bridgeid"))
+		usns = append(usns, p.MIMEHeader.Get("NT")+" "+p.MIMEHeader.Get("USN"))
+	}
+	assert.Equal(t, []string{
+		"upnp:rootdevice uuid:2f402f80-da50-11e1-9b23-001788255acc::upnp:rootdevice",
+		"uuid:2f402f80-da50-11e1-9b23-001788255acc uuid:2f402f80-da50-11e1-9b23-001788255acc",
+		"urn:schemas-upnp-org:device:basic:1 uuid:2f402f80-da50-11e1-9b23-001788255acc::urn:schemas-upnp-org:device:basic:1",
+	}, usns)
+
+	s.Shutdown()
+	// drain announcements sent before the shutdown
+	var byebye []*Packet
+	for len(byebye) < 3 {
+		for _, p := range receive(t, receiver, 1) {
+			if p.MIMEHeader.Get("NTS") == "ssdp:byebye" {
+				byebye = append(byebye, p)
+			}
+		}
+	}
+	for _, p := range byebye {
+		assert.Empty(t, p.MIMEHeader.Get("Location"))
+		assert.True(t, strings.HasPrefix(p.MIMEHeader.Get("USN"), "uuid:"+bridge.UUID))
+	}
+}
+
+func TestMaxAge(t *testing.T) {
+	assert.Equal(t, 100, maxAge(DefaultNotifyInterval))
+}
+
+func TestAdvertiserDisabled(t *testing.T) {
+	s, _ := localSSDP(t, WithNotifyInterval(0), WithBridges(&BridgeInfo{UUID: "x"}))
+	s.startAdvertiser()
+	assert.Nil(t, s.done)
+	s.Shutdown()
+
+	s, _ = localSSDP(t)
+	s.startAdvertiser()
+	assert.Nil(t, s.done)
+	s.Shutdown()
+}
@@ -4,19 +4,29 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"math/rand/v2"
 	"net"
 	"net/textproto"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// PacketCallback handles a received packet, the packet is owned by the callback and may be kept.
 type PacketCallback func(p *Packet)
 type Packet struct {
-	Client     *net.UDPAddr
+	Client *net.UDPAddr
+	// Local is the address of the interface the packet arrived on, nil when unknown.
+	Local      net.IP
 	Data       []byte
 	Method     string
 	RequestURI string
 	Proto      string
 	MIMEHeader textproto.MIMEHeader
+
+	// maxAge is the CACHE-CONTROL max-age of the announcements of the receiving SSDP
+	maxAge int
 }
 
 type BridgeInfo struct {
@@ -25,6 +35,25 @@ type BridgeInfo struct {
 	UUID         string
 }
 
+// location returns the bridge location with its host replaced by ip, keeping the port.
+func (b *BridgeInfo) location(ip net.IP) string {
+	if ip == nil {
+		return b.Location
+	}
+	u, err := url.Parse(b.Location)
+	if err != nil {
+		return b.Location
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(ip.String(), port)
+	} else if ip.To4() == nil {
+		u.Host = "[" + ip.String() + "]"
+	} else {
+		u.Host = ip.String()
+	}
+	return u.String()
+}
+
 func (p *Packet) Parse() (err error) {
 	tp := textproto.NewReader(bufio.NewReader(bytes.NewBuffer(p.Data)))
 	var headerLine string
@@ -44,34 +73,86 @@ func (p *Packet) Parse() (err error) {
 	return err
 }
 
+// maxMX is the largest MX honored, UPnP 1.1 requires treating larger values as 5 seconds.
+const maxMX = 5
+
+// MX returns the maximum response delay requested by the search, zero without a valid MX header.
+func (p *Packet) MX() time.Duration {
+	mx, err := strconv.Atoi(strings.TrimSpace(p.MIMEHeader.Get("Mx")))
+	if err != nil || mx <= 0 {
+		return 0
+	}
+	return time.Duration(min(mx, maxMX)) * time.Second
+}
+
+// Delay returns a random delay up to MX so that responses of many devices do not flood the client.
+func (p *Packet) Delay() time.Duration {
+	if mx := p.MX(); mx > 0 {
+		return rand.N(mx)
+	}
+	return 0
+}
+
+// matches returns the targets of the bridge which answer the search, all of them for ssdp:all
+// and none for search targets the bridge does not provide.
+func (p *Packet) matches(bridgeInfo *BridgeInfo) []target {
+	st := p.MIMEHeader.Get("St")
+	if st == "ssdp:all" {
+		return bridgeInfo.targets()
+	}
+	for _, t := range bridgeInfo.targets() {
+		if t.nt == st {
+			return []target{t}
+		}
+	}
+	return nil
+}
+
+// Responses returns a search response for each target of the bridge matching the search, their
+// max-age is the one of the NOTIFY announcements.
+func (p *Packet) Responses(bridgeInfo *BridgeInfo) []string {
+	age := p.maxAge
+	if age == 0 {
+		age = maxAge(DefaultNotifyInterval)
+	}
+	var result []string
+	for _, t := range p.matches(bridgeInfo) {
+		result = append(result, fmt.Sprintf("HTTP/1.1 200 OK\r\n"+
+			"EXT:\r\n"+
+			"CACHE-CONTROL: max-age=%d\r\n"+
+			"LOCATION: %s\r\n"+
+			"SERVER: %s\r\n"+
+			"hue-bridgeid: %s\r\n"+
+			"ST: %s\r\n"+
+			"USN: %s\r\n"+
+			"\r\n",
+			age,
+			bridgeInfo.location(p.Local),
+			serverHeader,
+			bridgeInfo.SerialNumber,
+			t.nt,
+			t.usn,
+		))
+	}
+	return result
+}
+
+// Reply sends the responses for the bridge to the client, nothing when the search does not match.
 func (p *Packet) Reply(bridgeInfo *BridgeInfo) error {
+	responses := p.Responses(bridgeInfo)
+	if len(responses) == 0 {
+		return nil
+	}
 	conn, err := net.DialUDP("udp", nil, p.Client)
 	if err != nil {
 		return err
 	}
 	defer func(conn *net.UDPConn) { _ = conn.Close() }(conn)
 
-	var serviceName = "urn:schemas-upnp-org:device:basic:1"
-
-	if p.MIMEHeader.Get("St") == "upnp:rootdevice" {
-		serviceName = fmt.Sprintf("uuid:%s::upnp:rootdevice", bridgeInfo.UUID)
+	for _, response := range responses {
+		if _, err = conn.Write([]byte(response)); err != nil {
+			return err
+		}
 	}
-
-	response := fmt.Sprintf("HTTP/1.1 200 OK\r\n"+
-		"CACHE-CONTROL: max-age=60\r\n"+
-		"EXT:\r\n"+
-		"LOCATION: %s\r\n"+
-		"SERVER: FreeRTOS/6.0.5, UPnP/1.0, IpBridge/1.16.0\r\n"+
-		"hue-bridgeid: %s\r\n"+
-		"ST: %s\r\n"+
-		"USN: %s\r\n"+
-		"\r\n",
-		bridgeInfo.Location,
-		bridgeInfo.SerialNumber,
-		p.MIMEHeader.Get("St"),
-		serviceName,
-	)
-
-	_, err = conn.Write([]byte(response))
-	return err
+	return nil
 }
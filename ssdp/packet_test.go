@@ -0,0 +1,124 @@
+package ssdp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBridge = &BridgeInfo{
+	Location:     "http://10.0.0.2:80/bridge/001788FFFE23BFC1/device.xml",
+	SerialNumber: "001788FFFE23BFC1",
+	UUID:         "2f402f80-da50-11e1-9b23-001788255acc",
+}
+
+// searches are M-SEARCH packets as sent by clients on the network
+var searches = map[string]string{
+	"echo basic": "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 15\r\n" +
+		"ST: urn:schemas-upnp-org:device:basic:1\r\n\r\n",
+	"echo all": "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 3\r\n" +
+		"ST: ssdp:all\r\n\r\n",
+	"hue app rootdevice": "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: upnp:rootdevice\r\n\r\n",
+	"uuid unicast": "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 10.0.0.2:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"ST: uuid:2f402f80-da50-11e1-9b23-001788255acc\r\n\r\n",
+	"other uuid": "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: uuid:7c9a0e2e-1c59-4d8f-9d1a-0c0ffee00000\r\n\r\n",
+	"chrome dial": "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 1\r\n" +
+		"ST: urn:dial-multiscreen-org:service:dial:1\r\n" +
+		"USER-AGENT: Google Chrome/120.0.6099.130 Windows\r\n\r\n",
+	"windows gateway": "M-SEARCH * HTTP/1.1\r\n" +
+		"Host:239.255.255.250:1900\r\n" +
+		"ST:urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\n" +
+		"Man:\"ssdp:discover\"\r\n" +
+		"MX:3\r\n\r\n",
+	"lowercase headers": "M-SEARCH * HTTP/1.1\r\n" +
+		"host: 239.255.255.250:1900\r\n" +
+		"man: \"ssdp:discover\"\r\n" +
+		"mx: 0\r\n" +
+		"st: upnp:rootdevice\r\n\r\n",
+}
+
+func TestPacketResponses(t *testing.T) {
+	rootdevice := "upnp:rootdevice"
+	uuid := "uuid:" + testBridge.UUID
+	basic := "urn:schemas-upnp-org:device:basic:1"
+
+	tests := []struct {
+		search string
+		mx     time.Duration
+		sts    []string
+	}{
+		{"echo basic", 5 * time.Second, []string{basic}},
+		{"echo all", 3 * time.Second, []string{rootdevice, uuid, basic}},
+		{"hue app rootdevice", 2 * time.Second, []string{rootdevice}},
+		{"uuid unicast", 0, []string{uuid}},
+		{"other uuid", time.Second, nil},
+		{"chrome dial", time.Second, nil},
+		{"windows gateway", 3 * time.Second, nil},
+		{"lowercase headers", 0, []string{rootdevice}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			p := &Packet{Data: []byte(searches[tt.search])}
+			require.NoError(t, p.Parse())
+			assert.Equal(t, "M-SEARCH", p.Method)
+			assert.Equal(t, tt.mx, p.MX())
+			delay := p.Delay()
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, tt.mx)
+
+			var sts []string
+			for _, response := range p.Responses(testBridge) {
+				r := &Packet{Data: []byte(response)}
+				require.NoError(t, r.Parse())
+				assert.Equal(t, "HTTP/1.1", r.Method)
+				assert.Equal(t, "max-age=100", r.MIMEHeader.Get("Cache-Control"))
+				assert.Equal(t, testBridge.Location, r.MIMEHeader.Get("Location"))
+				assert.Equal(t, testBridge.SerialNumber, r.MIMEHeader.Get("hue-bridgeid"))
+				assert.Contains(t, r.MIMEHeader.Get("Usn"), uuid)
+				sts = append(sts, r.MIMEHeader.Get("St"))
+			}
+			assert.Equal(t, tt.sts, sts)
+		})
+	}
+}
+
+func TestPacketReply(t *testing.T) {
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer func() { _ = client.Close() }()
+
+	p := &Packet{Client: client.LocalAddr().(*net.UDPAddr), Data: []byte(searches["echo all"])}
+	require.NoError(t, p.Parse())
+	require.NoError(t, p.Reply(testBridge))
+	responses := receive(t, client, 3)
+	assert.Equal(t, "upnp:rootdevice", responses[0].MIMEHeader.Get("St"))
+
+	p = &Packet{Client: client.LocalAddr().(*net.UDPAddr), Data: []byte(searches["chrome dial"])}
+	require.NoError(t, p.Parse())
+	require.NoError(t, p.Reply(testBridge))
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(100*time.Millisecond)))
+	_, _, err = client.ReadFromUDP(make([]byte, maxBufferSize))
+	assert.Error(t, err)
+}
@@ -1,78 +1,325 @@
 package ssdp
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 	"net"
-	"strings"
+	"sync"
+	"time"
 )
 
 const (
-	DefaultNetwork = "udp4"
-	DefaultAddress = "239.255.255.250:1900"
-	maxBufferSize  = 2048
+	DefaultNetwork     = "udp4"
+	DefaultAddress     = "239.255.255.250:1900"
+	DefaultAddressIPv6 = "[ff02::c]:1900"
+	DefaultWorkers     = 4
+	maxBufferSize      = 2048
 )
 
 type SSDP struct {
-	network       string
-	address       string
-	addr          *net.UDPAddr
-	interfaceName string
-	conn          *net.UDPConn
-	callback      PacketCallback
+	network        string
+	address        string
+	interfaceNames []string
+	ipv6           bool
+	listeners      []*listener
+	callback       PacketCallback
+	workers        int
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+
+	bridges        []*BridgeInfo
+	notifyInterval time.Duration
+	done           chan struct{}
+	wg             sync.WaitGroup
+}
+
+// listener receives the multicast group of one address family on all joined interfaces through a
+// single socket, the interface a packet arrived on is taken from its control message. Without
+// interfaces the group is joined on the system default interface.
+type listener struct {
+	conn       *net.UDPConn
+	group      *net.UDPAddr
+	interfaces []*net.Interface
+	// either one is set depending on the family of the group
+	ipv4 *ipv4.PacketConn
+	ipv6 *ipv6.PacketConn
+}
+
+func newListener(conn *net.UDPConn, group *net.UDPAddr) *listener {
+	l := &listener{conn: conn, group: group}
+	if group.IP.To4() != nil {
+		l.ipv4 = ipv4.NewPacketConn(conn)
+	} else {
+		l.ipv6 = ipv6.NewPacketConn(conn)
+	}
+	return l
 }
 
 func New(opts ...Option) *SSDP {
-	s := &SSDP{network: DefaultNetwork, address: DefaultAddress}
+	s := &SSDP{
+		network:        DefaultNetwork,
+		address:        DefaultAddress,
+		workers:        DefaultWorkers,
+		notifyInterval: DefaultNotifyInterval,
+	}
 	for _, opt := range opts {
 		opt(s)
 	}
 	return s
 }
 
+// Listen joins the multicast group on every configured interface, or the default one when none are
+// configured, and also the IPv6 group when enabled.
 func (s *SSDP) Listen() error {
-	var err error
-	s.addr, err = net.ResolveUDPAddr(s.network, s.address)
+	var interfaces []*net.Interface
+	for _, name := range s.interfaceNames {
+		ifi, err := net.InterfaceByName(name)
+		if err != nil {
+			return fmt.Errorf("interface %s: %w", name, err)
+		}
+		interfaces = append(interfaces, ifi)
+	}
+	err := s.listen(s.network, s.address, interfaces)
+	if err == nil && s.ipv6 {
+		err = s.listen("udp6", DefaultAddressIPv6, interfaces)
+	}
 	if err != nil {
+		s.close()
 		return err
 	}
-	var ifi *net.Interface
-	if s.interfaceName != "" {
-		var interfaces []net.Interface
-		interfaces, err = net.Interfaces()
-		if err != nil {
-			return err
+	s.startAdvertiser()
+	return nil
+}
+
+func (s *SSDP) listen(network, address string, interfaces []*net.Interface) error {
+	group, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return err
+	}
+	var first *net.Interface
+	if len(interfaces) > 0 {
+		first = interfaces[0]
+	}
+	conn, err := net.ListenMulticastUDP(network, first, group)
+	if err != nil {
+		if first != nil {
+			return fmt.Errorf("listen %s on %s: %w", address, first.Name, err)
 		}
-		for _, i := range interfaces {
-			if i.Name == s.interfaceName {
-				ifi = &i
-				break
-			}
+		return err
+	}
+	l := newListener(conn, group)
+	s.listeners = append(s.listeners, l)
+	if first == nil {
+		return nil
+	}
+	l.interfaces = interfaces
+	for _, ifi := range interfaces[1:] {
+		if err = l.join(ifi); err != nil {
+			return fmt.Errorf("listen %s on %s: %w", address, ifi.Name, err)
 		}
 	}
+	if err = l.watchInterfaces(); err != nil {
+		return fmt.Errorf("listen %s: %w", address, err)
+	}
+	return nil
+}
+
+func (l *listener) join(ifi *net.Interface) error {
+	group := &net.UDPAddr{IP: l.group.IP}
+	if l.ipv4 != nil {
+		return l.ipv4.JoinGroup(ifi, group)
+	}
+	return l.ipv6.JoinGroup(ifi, group)
+}
+
+// watchInterfaces requests the interface and destination address of every received packet.
+func (l *listener) watchInterfaces() error {
+	if l.ipv4 != nil {
+		return l.ipv4.SetControlMessage(ipv4.FlagInterface|ipv4.FlagDst, true)
+	}
+	return l.ipv6.SetControlMessage(ipv6.FlagInterface|ipv6.FlagDst, true)
+}
 
-	s.conn, err = net.ListenMulticastUDP(s.network, ifi, s.addr)
+// readFrom reads a packet along with the index of the interface it arrived on and its destination
+// address, both are only known once watchInterfaces was called.
+func (l *listener) readFrom(b []byte) (n int, client *net.UDPAddr, ifIndex int, dst net.IP, err error) {
+	var src net.Addr
+	if l.ipv4 != nil {
+		var cm *ipv4.ControlMessage
+		if n, cm, src, err = l.ipv4.ReadFrom(b); cm != nil {
+			ifIndex, dst = cm.IfIndex, cm.Dst
+		}
+	} else {
+		var cm *ipv6.ControlMessage
+		if n, cm, src, err = l.ipv6.ReadFrom(b); cm != nil {
+			ifIndex, dst = cm.IfIndex, cm.Dst
+		}
+	}
+	client, _ = src.(*net.UDPAddr)
+	return n, client, ifIndex, dst, err
+}
+
+// writeTo sends b to the group, out of ifi unless it is nil.
+func (l *listener) writeTo(b []byte, ifi *net.Interface) error {
+	var err error
+	if l.ipv4 != nil {
+		var cm *ipv4.ControlMessage
+		if ifi != nil {
+			cm = &ipv4.ControlMessage{IfIndex: ifi.Index}
+		}
+		_, err = l.ipv4.WriteTo(b, cm, l.group)
+	} else {
+		var cm *ipv6.ControlMessage
+		if ifi != nil {
+			cm = &ipv6.ControlMessage{IfIndex: ifi.Index}
+		}
+		_, err = l.ipv6.WriteTo(b, cm, l.group)
+	}
 	return err
 }
 
-func (s *SSDP) Read() {
+// joined returns the joined interface with index, nil when the group is not joined on it.
+func (l *listener) joined(index int) *net.Interface {
+	for _, ifi := range l.interfaces {
+		if ifi.Index == index {
+			return ifi
+		}
+	}
+	return nil
+}
+
+// localIP returns the address to announce to client for a packet received on the interface with
+// ifIndex, the destination of a unicast search or else an address of the interface. The result is
+// nil for the system default interface.
+func (l *listener) localIP(ifIndex int, dst net.IP, client net.IP) net.IP {
+	ifi := l.joined(ifIndex)
+	if ifi == nil {
+		return nil
+	}
+	if dst != nil && !dst.IsMulticast() && !dst.IsUnspecified() {
+		return dst
+	}
+	return interfaceIP(ifi, l.group.IP.To4() != nil, client)
+}
+
+// interfaceIP returns the address of ifi in the family of the group, preferring one in the client
+// network when client is given.
+func interfaceIP(ifi *net.Interface, ipv4 bool, client net.IP) net.IP {
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil
+	}
+	var result net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || (ipNet.IP.To4() != nil) != ipv4 {
+			continue
+		}
+		if client != nil && ipNet.Contains(client) && !ipNet.IP.IsLinkLocalUnicast() {
+			return ipNet.IP
+		}
+		// link local addresses only work together with a zone, which is unknown to clients
+		if result == nil || (result.IsLinkLocalUnicast() && !ipNet.IP.IsLinkLocalUnicast()) {
+			result = ipNet.IP
+		}
+	}
+	return result
+}
+
+// Read passes the packets received on all listeners to the callback on a pool of workers until
+// ctx is cancelled or Shutdown is called. While all workers are busy reading pauses and further
+// datagrams queue up in the socket buffers.
+func (s *SSDP) Read(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	packets := make(chan *Packet, s.workers)
+	var workers sync.WaitGroup
+	for range s.workers {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for p := range packets {
+				if s.callback != nil {
+					s.callback(p)
+				}
+			}
+		}()
+	}
+
+	var readers sync.WaitGroup
+	for _, l := range s.listeners {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			s.read(ctx, l, packets)
+		}()
+	}
+	// unblock the readers once cancelled
+	go func() {
+		<-ctx.Done()
+		for _, l := range s.listeners {
+			_ = l.conn.SetReadDeadline(time.Now())
+		}
+	}()
+
+	readers.Wait()
+	close(packets)
+	workers.Wait()
+}
+
+func (s *SSDP) read(ctx context.Context, l *listener, packets chan<- *Packet) {
+	// the buffer is only used for reading, each packet gets a copy callbacks may keep
 	buffer := make([]byte, maxBufferSize)
 	for {
-		n, client, err := s.conn.ReadFromUDP(buffer)
+		n, client, ifIndex, dst, err := l.readFrom(buffer)
 		if err != nil {
-			if strings.Contains(err.Error(), "use of closed network connection") {
-				s.conn = nil
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
 				return
 			}
 			continue
 		}
-		if s.callback != nil {
-			s.callback(&Packet{Client: client, Data: buffer[:n]})
+		// Linux delivers the group traffic of every interface any socket joined, unless disabled
+		// with IP_MULTICAST_ALL, so packets of other interfaces are dropped here
+		if client == nil || (len(l.interfaces) > 0 && l.joined(ifIndex) == nil) {
+			continue
+		}
+		p := &Packet{
+			Client: client,
+			Local:  l.localIP(ifIndex, dst, client.IP),
+			Data:   bytes.Clone(buffer[:n]),
+			maxAge: maxAge(s.notifyInterval),
+		}
+		select {
+		case packets <- p:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
+// Shutdown sends ssdp:byebye for the advertised bridges and stops listening.
 func (s *SSDP) Shutdown() {
-	if s.conn != nil {
-		_ = s.conn.Close()
+	s.stopAdvertiser()
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	s.close()
+}
+
+func (s *SSDP) close() {
+	for _, l := range s.listeners {
+		_ = l.conn.Close()
 	}
 }
 
@@ -96,8 +343,44 @@ func WithAddress(address string) Option {
 	}
 }
 
+// WithInterface listens on the named interface in addition to other configured interfaces.
 func WithInterface(name string) Option {
 	return func(s *SSDP) {
-		s.interfaceName = name
+		s.interfaceNames = append(s.interfaceNames, name)
+	}
+}
+
+// WithInterfaces listens on each of the named interfaces.
+func WithInterfaces(names ...string) Option {
+	return func(s *SSDP) {
+		s.interfaceNames = append(s.interfaceNames, names...)
+	}
+}
+
+// WithWorkers sets the number of callbacks running concurrently, at least one.
+func WithWorkers(workers int) Option {
+	return func(s *SSDP) {
+		s.workers = max(1, workers)
+	}
+}
+
+// WithIPv6 also joins the IPv6 link local multicast group ff02::c.
+func WithIPv6(enabled bool) Option {
+	return func(s *SSDP) {
+		s.ipv6 = enabled
+	}
+}
+
+// WithBridges advertises the bridges with NOTIFY messages.
+func WithBridges(bridges ...*BridgeInfo) Option {
+	return func(s *SSDP) {
+		s.bridges = bridges
+	}
+}
+
+// WithNotifyInterval sets the interval of the ssdp:alive announcements, zero disables them.
+func WithNotifyInterval(interval time.Duration) Option {
+	return func(s *SSDP) {
+		s.notifyInterval = interval
 	}
 }
@@ -0,0 +1,305 @@
+package ssdp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/ipv4"
+)
+
+func loopback(t *testing.T) *net.Interface {
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			return &ifi
+		}
+	}
+	t.Skip("no loopback interface")
+	return nil
+}
+
+func TestListenUnknownInterface(t *testing.T) {
+	s := New(WithInterfaces("ehugo-missing0"))
+	assert.ErrorContains(t, s.Listen(), "ehugo-missing0")
+	assert.Empty(t, s.listeners)
+}
+
+func TestListenerLocalIP(t *testing.T) {
+	ifi := loopback(t)
+	group4, err := net.ResolveUDPAddr("udp4", DefaultAddress)
+	require.NoError(t, err)
+	group6, err := net.ResolveUDPAddr("udp6", DefaultAddressIPv6)
+	require.NoError(t, err)
+	group := net.ParseIP("239.255.255.250")
+
+	l := &listener{group: group4, interfaces: []*net.Interface{ifi}}
+	assert.Equal(t, "127.0.0.1", l.localIP(ifi.Index, group, net.ParseIP("127.0.0.9")).String())
+	assert.Equal(t, "127.0.0.1", l.localIP(ifi.Index, nil, nil).String())
+	// unicast searches are answered with the address they were sent to
+	assert.Equal(t, "127.0.0.5", l.localIP(ifi.Index, net.ParseIP("127.0.0.5"), nil).String())
+	// packets of interfaces the group was not joined on are unknown
+	assert.Nil(t, l.localIP(ifi.Index+100, group, nil))
+
+	l = &listener{group: group6, interfaces: []*net.Interface{ifi}}
+	if ip := l.localIP(ifi.Index, nil, nil); ip != nil {
+		assert.Equal(t, "::1", ip.String())
+	}
+
+	l = &listener{group: group4}
+	assert.Nil(t, l.localIP(ifi.Index, group, net.ParseIP("127.0.0.9")))
+}
+
+// multicastInterface returns an interface other than the loopback that supports IPv4 multicast.
+func multicastInterface(t *testing.T) (*net.Interface, net.IP) {
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	for _, ifi := range interfaces {
+		if ifi.Flags&net.FlagLoopback != 0 || ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		if ip := interfaceIP(&ifi, true, nil); ip != nil {
+			return &ifi, ip
+		}
+	}
+	t.Skip("no multicast interface")
+	return nil, nil
+}
+
+// listenSSDP listens on the interfaces like the service does and returns the received packets.
+func listenSSDP(t *testing.T, address string, interfaces ...string) <-chan *Packet {
+	packets := make(chan *Packet, 10)
+	s := New(WithAddress(address), WithInterfaces(interfaces...), WithCallback(func(p *Packet) { packets <- p }))
+	require.NoError(t, s.Listen())
+	ctx, cancel := context.WithCancel(context.Background())
+	go s.Read(ctx)
+	t.Cleanup(func() {
+		cancel()
+		s.Shutdown()
+	})
+	return packets
+}
+
+func expectPackets(t *testing.T, packets <-chan *Packet, count int) []*Packet {
+	var result []*Packet
+	timeout := time.After(300 * time.Millisecond)
+	for {
+		select {
+		case p := <-packets:
+			result = append(result, p)
+		case <-timeout:
+			require.Len(t, result, count)
+			return result
+		}
+	}
+}
+
+func TestListenInterfaces(t *testing.T) {
+	lo := loopback(t)
+	ifi, ip := multicastInterface(t)
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	require.NoError(t, err)
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, probe.Close())
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: port}
+	search := []byte(searches["hue app rootdevice"])
+
+	both := listenSSDP(t, group.String(), lo.Name, ifi.Name)
+
+	// a unicast search is answered with the address it was sent to
+	sender, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer func() { _ = sender.Close() }()
+	_, err = sender.WriteToUDP(search, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	require.NoError(t, err)
+	packets := expectPackets(t, both, 1)
+	assert.Equal(t, "127.0.0.1", packets[0].Local.String())
+
+	// a second listener on the loopback only shares the port and, on Linux, the group traffic of
+	// all interfaces, it must ignore a search arriving on the other interface
+	loOnly := listenSSDP(t, group.String(), lo.Name)
+
+	multicast, err := net.ListenUDP("udp4", &net.UDPAddr{IP: ip})
+	require.NoError(t, err)
+	defer func() { _ = multicast.Close() }()
+	pc := ipv4.NewPacketConn(multicast)
+	require.NoError(t, pc.SetMulticastInterface(ifi))
+	require.NoError(t, pc.SetMulticastLoopback(true))
+	_, err = pc.WriteTo(search, nil, group)
+	require.NoError(t, err)
+
+	packets = expectPackets(t, both, 1)
+	assert.Equal(t, ip.String(), packets[0].Local.String())
+	require.NoError(t, packets[0].Parse())
+	assert.Equal(t, "M-SEARCH", packets[0].Method)
+	expectPackets(t, loOnly, 0)
+}
+
+func TestBridgeLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		ip       string
+		expected string
+	}{
+		{"http://10.0.0.2:80/bridge/1/device.xml", "", "http://10.0.0.2:80/bridge/1/device.xml"},
+		{"http://:80/bridge/1/device.xml", "192.168.5.1", "http://192.168.5.1:80/bridge/1/device.xml"},
+		{"http://10.0.0.2/bridge/1/device.xml", "192.168.5.1", "http://192.168.5.1/bridge/1/device.xml"},
+		{"http://10.0.0.2:8080/bridge/1/device.xml", "fd00::2", "http://[fd00::2]:8080/bridge/1/device.xml"},
+		{"http://10.0.0.2/bridge/1/device.xml", "fd00::2", "http://[fd00::2]/bridge/1/device.xml"},
+	}
+	for _, tt := range tests {
+		b := &BridgeInfo{Location: tt.location}
+		assert.Equal(t, tt.expected, b.location(net.ParseIP(tt.ip)), tt.location)
+	}
+}
+
+func TestResponsesLocalLocation(t *testing.T) {
+	p := &Packet{
+		Client: &net.UDPAddr{IP: net.ParseIP("fd00::9"), Port: 50000},
+		Local:  net.ParseIP("fd00::2"),
+		Data:   []byte(searches["hue app rootdevice"]),
+	}
+	require.NoError(t, p.Parse())
+	responses := p.Responses(testBridge)
+	require.Len(t, responses, 1)
+	r := &Packet{Data: []byte(responses[0])}
+	require.NoError(t, r.Parse())
+	assert.Equal(t, "http://[fd00::2]:80/bridge/001788FFFE23BFC1/device.xml", r.MIMEHeader.Get("Location"))
+	assert.Empty(t, r.MIMEHeader.Get("Host"))
+}
+
+// TestReadConcurrentCallbacks is meant to run with -race, slow callbacks on several workers
+// must each see the data of their own packet.
+func TestReadConcurrentCallbacks(t *testing.T) {
+	const count = 200
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	var mismatched atomic.Int32
+
+	s, _ := localSSDP(t, WithWorkers(8), WithCallback(func(p *Packet) {
+		expected := string(p.Data)
+		time.Sleep(time.Millisecond)
+		if string(p.Data) != expected {
+			mismatched.Add(1)
+		}
+		mu.Lock()
+		received[expected] = true
+		mu.Unlock()
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Read(ctx)
+		close(done)
+	}()
+
+	sender, err := net.DialUDP("udp4", nil, s.listeners[0].conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer func() { _ = sender.Close() }()
+	for i := 0; i < count; i++ {
+		_, err = fmt.Fprintf(sender, "packet %d", i)
+		require.NoError(t, err)
+		if i%20 == 0 {
+			// give the reader a chance to keep up with the socket buffer
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == count
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, mismatched.Load())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after cancel")
+	}
+}
+
+// TestReadDeferredCallbacks is meant to run with -race, callbacks keep the packets and read
+// their data after returning while further packets are received.
+func TestReadDeferredCallbacks(t *testing.T) {
+	const count = 100
+	kept := make(chan *Packet, count)
+	s, _ := localSSDP(t, WithCallback(func(p *Packet) { kept <- p }))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Read(ctx)
+
+	sender, err := net.DialUDP("udp4", nil, s.listeners[0].conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer func() { _ = sender.Close() }()
+	go func() {
+		for i := 0; i < count; i++ {
+			_, _ = fmt.Fprintf(sender, "packet %03d", i)
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < count {
+		select {
+		case p := <-kept:
+			// give the reader time to receive more packets before looking at the data
+			time.Sleep(2 * time.Millisecond)
+			data := string(p.Data)
+			assert.Regexp(t, `^packet \d{3}$`, data)
+			assert.False(t, seen[data], "duplicate %s", data)
+			seen[data] = true
+		case <-timeout:
+			t.Fatalf("received %d of %d packets", len(seen), count)
+		}
+	}
+}
+
+func TestReadMaxAge(t *testing.T) {
+	packets := make(chan *Packet, 1)
+	s, _ := localSSDP(t, WithNotifyInterval(10*time.Second), WithCallback(func(p *Packet) { packets <- p }))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Read(ctx)
+
+	sender, err := net.DialUDP("udp4", nil, s.listeners[0].conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer func() { _ = sender.Close() }()
+	_, err = sender.Write([]byte(searches["hue app rootdevice"]))
+	require.NoError(t, err)
+
+	select {
+	case p := <-packets:
+		require.NoError(t, p.Parse())
+		responses := p.Responses(testBridge)
+		require.Len(t, responses, 1)
+		assert.Contains(t, responses[0], "CACHE-CONTROL: max-age=20\r\n")
+	case <-time.After(time.Second):
+		t.Fatal("search not received")
+	}
+}
+
+func TestReadShutdown(t *testing.T) {
+	s, _ := localSSDP(t)
+	done := make(chan struct{})
+	go func() {
+		s.Read(context.Background())
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	s.Shutdown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return after Shutdown")
+	}
+}